@@ -5,50 +5,100 @@
 package tbotapi
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
 // A TelegramBotAPI is an API Client for one Telegram bot.
-// Create a new client by calling the New() function.
+// Create a new client by calling the New() or NewWithOptions() function.
 type TelegramBotAPI struct {
-	ID       int            // The bots ID.
-	Name     string         // The bots Name as seen by users.
-	Username string         // The bots username.
-	Updates  chan BotUpdate // A channel providing updates this bot receives.
-	baseURIs map[method]string
-	closed   chan struct{}
-	c        *client // Client used to do all outgoing requests.
-	updateC  *client // Special client just used to get updates.
-	wg       sync.WaitGroup
+	ID          int            // The bots ID.
+	Name        string         // The bots Name as seen by users.
+	Username    string         // The bots username.
+	Updates     chan BotUpdate // A channel providing updates this bot receives.
+	closed      chan struct{}
+	c           *client // Client used to do all outgoing requests.
+	updateC     *client // Special client just used to get updates.
+	pollMu      sync.Mutex
+	poll        PollConfig
+	pollRetry   RetryPolicy   // Backoff between failed polls, never nil.
+	retryHook   RetryHook     // May be nil.
+	flood       *floodControl // Flood control for outgoing messages, may be nil.
+	metrics     Metrics       // May be nil.
+	unwatch     func()        // Stops sampling the pending updates, may be nil.
+	offsetStore OffsetStore   // May be nil.
+	ackTimeout  time.Duration // Zero or less to never warn about unacknowledged updates.
+	wg          sync.WaitGroup
+
+	cancel       context.CancelFunc // Cancels the update loop.
+	shutdownOnce sync.Once
+	deliverMu    sync.RWMutex  // Held for writing while Updates is closed.
+	offset       int           // The offset to confirm on shutdown, set by the update loop.
+	confirmed    int           // The offset last sent to the API, set by the update loop.
+	received     chan struct{} // Signaled by consumers reading from Updates.
+	delivered    []int         // IDs delivered by the update loop since Updates was last empty, 0 for errors.
+}
+
+// String returns a description of the bot. It never contains the token.
+func (api *TelegramBotAPI) String() string {
+	return fmt.Sprintf("TelegramBotAPI(%d, @%s)", api.ID, api.Username)
+}
+
+// GoString is like String, so that %#v does not print the token either.
+func (api *TelegramBotAPI) GoString() string {
+	return api.String()
 }
 
 // BotUpdate represents an update the bot received.
 // Always check if an error occurred before using the update.
 type BotUpdate struct {
-	update Update
-	err    error
+	update   Update
+	err      error
+	ack      func()          // Acknowledges the update, may be nil.
+	received chan<- struct{} // Wakes up the update loop once read, may be nil.
+}
+
+// Ack acknowledges that the update was handled.
+// It must be called for every update if an OffsetStore is set, see
+// OffsetStore. Otherwise, it does nothing.
+// Router and Dispatcher acknowledge updates automatically.
+func (u *BotUpdate) Ack() {
+	if u.ack != nil {
+		u.ack()
+	}
 }
 
 // Update returns the contained update.
 func (u *BotUpdate) Update() Update {
+	u.read()
 	return u.update
 }
 
 // Error returns != nil, if an error occurred during retrieval of the
 // update.
 func (u *BotUpdate) Error() error {
+	u.read()
 	return u.err
 }
 
-const apiBaseURI string = "https://api.telegram.org/bot%s"
+// read tells the update loop that an update was taken from the Updates
+// channel, see awaitReceived.
+func (u *BotUpdate) read() {
+	if u.received == nil {
+		return
+	}
+	select {
+	case u.received <- struct{}{}:
+	default:
+		// A wake-up is pending already.
+	}
+}
 
 // New creates a new API Client for a Telegram bot using the apiKey
 // provided.
@@ -58,105 +108,234 @@ const apiBaseURI string = "https://api.telegram.org/bot%s"
 // This bot uses long polling to retrieve its updates. If a webhook was set
 // for the given apiKey, this will remove it.
 func New(apiKey string) (*TelegramBotAPI, error) {
-	toReturn := TelegramBotAPI{
-		Updates:  make(chan BotUpdate),
-		baseURIs: createEndpoints(fmt.Sprintf(apiBaseURI, apiKey)),
-		closed:   make(chan struct{}),
-		c:        newClient(fmt.Sprintf(apiBaseURI, apiKey)),
-		updateC:  newClient(fmt.Sprintf(apiBaseURI, apiKey)),
+	return NewWithOptions(apiKey)
+}
+
+// NewWithOptions creates a new API Client for a Telegram bot using the
+// apiKey and options provided.
+// It will call the GetMe method to retrieve the bots id, name and
+// username.
+//
+// Unless WithoutAutoStart is given, this bot uses long polling to retrieve
+// its updates and, if a webhook was set for the given apiKey, this will
+// remove it.
+func NewWithOptions(apiKey string, opts ...Option) (*TelegramBotAPI, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
 	}
-	user, err := toReturn.GetMe()
+
+	toReturn, err := newAPI(apiKey, o)
 	if err != nil {
 		return nil, err
 	}
-	toReturn.ID = user.User.ID
-	toReturn.Name = user.User.FirstName
-	toReturn.Username = *user.User.Username
 
-	err = toReturn.removeWebhook()
+	if o.noAutoStart {
+		return toReturn, nil
+	}
+
+	err = toReturn.DeleteWebhook(false)
 	if err != nil {
+		toReturn.Close()
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	toReturn.cancel = cancel
 	toReturn.wg.Add(1)
-	go toReturn.updateLoop()
+	go toReturn.updateLoop(ctx)
 
-	return &toReturn, nil
+	return toReturn, nil
 }
 
-// NewWithWebhook creates a new API client for a Telegram bot using the apiKey
-// provided. It will call the GetMe method to retrieve the bots id, name and
-// username.
-// In addition to the API client, a http.HandlerFunc will be returned. This
-// handler func reacts to webhook requests and will put updates into the
-// Updates channel.
-func NewWithWebhook(apiKey, webhookURL, certificate string) (*TelegramBotAPI, http.HandlerFunc, error) {
-	toReturn := TelegramBotAPI{
-		Updates:  make(chan BotUpdate),
-		baseURIs: createEndpoints(fmt.Sprintf(apiBaseURI, apiKey)),
-		closed:   make(chan struct{}),
-		c:        newClient(fmt.Sprintf(apiBaseURI, apiKey)),
-		updateC:  newClient(fmt.Sprintf(apiBaseURI, apiKey)),
+// newAPI creates a new API client and populates its ID, Name and Username
+// by calling GetMe.
+func newAPI(apiKey string, o *options) (*TelegramBotAPI, error) {
+	baseURI := o.baseURL + "/bot" + apiKey
+	closed := make(chan struct{})
+	toReturn := &TelegramBotAPI{
+		Updates:     make(chan BotUpdate, o.updatesBuffer),
+		closed:      closed,
+		received:    make(chan struct{}, 1),
+		c:           newClient(baseURI, o, closed),
+		updateC:     newClient(baseURI, o, closed),
+		poll:        o.poll,
+		pollRetry:   o.retryPolicy,
+		retryHook:   o.retryHook,
+		metrics:     o.metrics,
+		offsetStore: o.offsetStore,
+		ackTimeout:  o.ackTimeout,
 	}
+	if o.floodLimits != nil {
+		toReturn.flood = newFloodControl(*o.floodLimits)
+	}
+	// The update loop backs off between failed polls itself, see
+	// pollBackoff.
+	toReturn.updateC.retryPolicy = nil
+	if toReturn.pollRetry == nil {
+		toReturn.pollRetry = DefaultRetryPolicy
+	}
+
 	user, err := toReturn.GetMe()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	toReturn.ID = user.User.ID
 	toReturn.Name = user.User.FirstName
 	toReturn.Username = *user.User.Username
 
-	file, err := os.Open(certificate)
+	if o.metrics != nil {
+		toReturn.unwatch = o.metrics.WatchPendingUpdates(func() int {
+			return len(toReturn.Updates)
+		})
+	}
+
+	return toReturn, nil
+}
+
+// NewWithWebhook creates a new API client for a Telegram bot using the apiKey
+// provided. It will call the GetMe method to retrieve the bots id, name and
+// username.
+// It then sets a webhook for webhookURL, uploading the public key
+// certificate at the path given in certificate, unless it is empty. Use
+// SetWebhook for more options.
+// In addition to the API client, a http.HandlerFunc will be returned. This
+// handler func reacts to webhook requests and will put updates into the
+// Updates channel. It is the ServeHTTP method of a WebhookServer with the
+// default configuration; use NewWebhookServer for more control.
+// A random secret token is registered with the webhook and requests without
+// it are rejected.
+func NewWithWebhook(apiKey, webhookURL, certificate string) (*TelegramBotAPI, http.HandlerFunc, error) {
+	toReturn, err := newAPI(apiKey, defaultOptions())
 	if err != nil {
 		return nil, nil, err
 	}
 
-	err = toReturn.setWebhook(webhookURL, certificate, file)
+	secret, err := GenerateSecretToken()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	updateFunc := func(w http.ResponseWriter, r *http.Request) {
-		bytes, err := ioutil.ReadAll(r.Body)
+	params := WebhookParams{URL: webhookURL, SecretToken: secret}
+	if certificate != "" {
+		file, err := os.Open(certificate)
 		if err != nil {
-			toReturn.Updates <- BotUpdate{err: err}
-			return
+			return nil, nil, err
 		}
+		defer file.Close()
 
-		update := &Update{}
-		err = json.Unmarshal(bytes, update)
-		if err != nil {
-			toReturn.Updates <- BotUpdate{err: err}
-			return
-		}
+		cert := FromReader(filepath.Base(certificate), file)
+		params.Certificate = &cert
+	}
 
-		toReturn.Updates <- BotUpdate{update: *update}
+	err = toReturn.SetWebhook(params)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return &toReturn, updateFunc, nil
+	ws := toReturn.NewWebhookServer(WebhookConfig{SecretToken: secret})
+	return toReturn, ws.ServeHTTP, nil
 }
 
-// Close shuts down this client.
-// Until Close returns, new updates and errors will be put into the
-// respective channels.
-// Note that, if no updates are received, this function may block for up to
-// one minute, which is the time interval
-// for long polling.
+// Close shuts down this client, see Shutdown.
+// It waits at most five seconds for the offset to be confirmed.
 func (api *TelegramBotAPI) Close() {
-	select {
-	case <-api.closed:
-		return
-	default:
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	api.Shutdown(ctx)
+}
+
+// closeTimeout bounds the time Close waits for the offset to be confirmed.
+const closeTimeout = 5 * time.Second
+
+// Shutdown shuts down this client.
+//
+// It cancels the long poll in progress right away. Then, the updates that
+// were received from the Updates channel, or acknowledged if an
+// OffsetStore is set, are confirmed to the API, so that they are not
+// received again. Finally, the Updates channel is closed, so consumers can
+// range over it.
+// Updates that were retrieved but not yet delivered are dropped, and
+// updates still buffered in the Updates channel are not confirmed; they
+// will be received again by the next client.
+//
+// The context bounds the time to wait for the confirmation. Shutdown
+// returns the error of the confirmation, if any. Calling Shutdown more
+// than once has no effect.
+func (api *TelegramBotAPI) Shutdown(ctx context.Context) error {
+	var err error
+	api.shutdownOnce.Do(func() {
+		close(api.closed)
+		if api.cancel != nil {
+			api.cancel()
+		}
+		api.wg.Wait()
+
+		offset := api.unreceivedOffset(api.offset)
+		if offset > api.confirmed {
+			// A poll without timeout confirms all updates before the
+			// offset. Returned updates are not confirmed and thus ignored.
+			_, err = api.getUpdatesWith(ctx, api.updateC, offset, 1, 0, nil)
+		}
+
+		api.deliverMu.Lock()
+		close(api.Updates)
+		api.deliverMu.Unlock()
+
+		if api.unwatch != nil {
+			api.unwatch()
+		}
+	})
+	return err
+}
+
+// unreceivedOffset lowers offset to the first update delivered by the
+// update loop that is still buffered in the Updates channel, as that one
+// was not received by a consumer yet.
+// It must be called after the update loop stopped.
+func (api *TelegramBotAPI) unreceivedOffset(offset int) int {
+	api.deliverMu.Lock()
+	defer api.deliverMu.Unlock()
+
+	// The buffered items are the last ones delivered. Consumers may take
+	// more in the meantime, which only means they are received again.
+	i := len(api.delivered) - len(api.Updates)
+	if i < 0 {
+		i = 0
+	}
+	for _, id := range api.delivered[i:] {
+		if id == 0 {
+			continue
+		}
+		if id < offset {
+			offset = id
+		}
+		break
 	}
-	close(api.closed)
-	api.wg.Wait()
+
+	return offset
 }
 
-func (api *TelegramBotAPI) updateLoop() {
+func (api *TelegramBotAPI) updateLoop(ctx context.Context) {
 	defer api.wg.Done()
-	updates, err := api.getUpdates()
-	offset := -1
+	offset := 0
+	if api.offsetStore != nil {
+		var err error
+		offset, err = api.offsetStore.Load()
+		if err != nil {
+			api.deliverPolled(BotUpdate{err: err})
+		}
+	}
+	api.confirmed = offset
 
+	// Let Shutdown confirm what was delivered since the last poll.
+	defer func() {
+		api.offset = offset
+	}()
+
+	failures := 0
+	var longest time.Duration
 	for {
 		select {
 		case <-api.closed:
@@ -164,112 +343,200 @@ func (api *TelegramBotAPI) updateLoop() {
 		default:
 		}
 
+		updates, err := api.getUpdates(ctx, offset)
 		if err != nil {
-			api.Updates <- BotUpdate{err: err}
-		} else {
-			updates.sort()
+			if ctx.Err() != nil {
+				// Canceled by Shutdown.
+				return
+			}
+			api.deliverPolled(BotUpdate{err: err})
+
+			failures++
+			wait := api.pollBackoff(failures, err, longest)
+			if wait > longest {
+				longest = wait
+			}
+			if api.retryHook != nil {
+				api.retryHook(string(getUpdates), failures, err, wait)
+			}
+
+			t := time.NewTimer(wait)
+			select {
+			case <-api.closed:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			continue
+		}
+		failures, longest = 0, 0
+		api.confirmed = offset
+
+		if api.offsetStore == nil {
 			for _, update := range updates.Update {
-				api.Updates <- BotUpdate{update: update}
-				offset = update.ID
+				if !api.deliverPolled(BotUpdate{update: update}) {
+					return
+				}
+				offset = update.ID + 1
 			}
+			// Polling with the new offset confirms the updates, so they
+			// must have been received from the buffer first.
+			if !api.awaitReceived() {
+				return
+			}
+			continue
 		}
 
-		if offset == -1 {
-			updates, err = api.getUpdates()
-		} else {
-			updates, err = api.getUpdatesByOffset(offset + 1)
+		// Only retrieve the next batch once this one is handled, because
+		// retrieving it confirms this one to the API.
+		acks := newBatchAcks(len(updates.Update))
+		for i, update := range updates.Update {
+			api.deliver(BotUpdate{update: update, ack: acks.ackFunc(i)})
+		}
+		var ok bool
+		offset, ok = api.awaitAcks(updates.Update, acks, offset)
+		if !ok {
+			return
 		}
 	}
 }
 
-func (api *TelegramBotAPI) getUpdates() (*updateResponse, error) {
-	resp := &updateResponse{}
-	response, err := api.updateC.getQuerystring(getUpdates, resp, map[string]string{"timeout": fmt.Sprint(60)})
-
-	if err != nil {
-		if response != nil {
-			if response.StatusCode() < 500 {
-				return nil, err
-			}
-			//Telegram server problems, retry later...
-			time.Sleep(time.Duration(5) * time.Second)
-			return api.getUpdates()
+// awaitReceived waits until the Updates buffer is empty. Consumers wake it
+// up whenever they read an update. It returns false if the client was
+// closed in the meantime.
+func (api *TelegramBotAPI) awaitReceived() bool {
+	for len(api.Updates) > 0 {
+		select {
+		case <-api.closed:
+			return false
+		case <-api.received:
 		}
-		return nil, err
 	}
-	err = check(&resp.baseResponse)
-	if err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return true
 }
 
-func (api *TelegramBotAPI) getUpdatesByOffset(offset int) (*updateResponse, error) {
-	resp := &updateResponse{}
-	response, err := api.updateC.getQuerystring(getUpdates, resp, map[string]string{
-		"timeout": fmt.Sprint(60),
-		"offset":  fmt.Sprint(offset),
-	})
+// deliverPolled delivers an update or an error of the update loop and
+// records it, so that Shutdown can tell whether it was received.
+func (api *TelegramBotAPI) deliverPolled(u BotUpdate) bool {
+	if len(api.Updates) == 0 {
+		// Everything recorded so far was received.
+		api.delivered = api.delivered[:0]
+	}
 
-	if err != nil {
-		if response != nil {
-			if response.StatusCode() < 500 {
-				return nil, err
-			}
-			//Telegram server problems, retry later...
-			time.Sleep(time.Duration(5) * time.Second)
-			return api.getUpdatesByOffset(offset)
-		}
-		return nil, err
+	u.received = api.received
+	if !api.deliver(u) {
+		return false
 	}
-	err = check(&resp.baseResponse)
-	if err != nil {
-		return nil, err
+
+	id := 0
+	if u.err == nil {
+		id = u.update.ID
 	}
-	return resp, nil
+	api.delivered = append(api.delivered, id)
+	return true
 }
 
-func (api *TelegramBotAPI) setWebhook(url, fileName string, r io.Reader) error {
-	req := outgoingSetWebhook{
-		URL: url,
-		outgoingFileBase: outgoingFileBase{
-			fileName: fileName,
-			r:        r,
-		},
+// deliver puts an update into the Updates channel and reports it.
+// Updates are dropped once the client is closed, so that the update loop
+// cannot block on a channel nobody reads anymore. It returns whether the
+// update was delivered.
+func (api *TelegramBotAPI) deliver(u BotUpdate) bool {
+	api.deliverMu.RLock()
+	defer api.deliverMu.RUnlock()
+
+	select {
+	case <-api.closed:
+		return false
+	default:
+	}
+
+	if api.metrics != nil && u.err == nil {
+		api.metrics.IncUpdates(u.update.Type())
+	}
+
+	select {
+	case api.Updates <- u:
+		return true
+	case <-api.closed:
+		return false
 	}
-	resp := &baseResponse{}
+}
+
+// getUpdates performs one long poll for updates, starting at offset,
+// using the current PollConfig.
+// Failed polls are not repeated, the update loop backs off itself.
+func (api *TelegramBotAPI) getUpdates(ctx context.Context, offset int) (*updateResponse, error) {
+	cfg := api.PollConfig()
+	return api.getUpdatesWith(ctx, api.updateC, offset, cfg.Limit, cfg.Timeout, cfg.AllowedUpdates)
+}
 
-	_, err := api.c.uploadFile(setWebhook, resp, file{fieldName: "certificate", fileName: req.fileName, r: req.r}, &req)
+// SetWebhook sets a webhook, making the API send updates to the given URL
+// instead of answering getUpdates. The client must not poll for updates,
+// see WithoutAutoStart.
+func (api *TelegramBotAPI) SetWebhook(params WebhookParams) error {
+	return api.SetWebhookContext(context.Background(), params)
+}
+
+// SetWebhookContext is like SetWebhook, but uses the provided context for
+// the request.
+func (api *TelegramBotAPI) SetWebhookContext(ctx context.Context, params WebhookParams) error {
+	fields, files, err := params.fields()
 	if err != nil {
 		return err
 	}
 
-	return check(resp)
+	if len(files) > 0 {
+		return api.c.uploadFile(ctx, setWebhook, &baseResponse{}, files, fields)
+	}
+	return api.c.postForm(ctx, setWebhook, &baseResponse{}, fields)
+}
+
+// DeleteWebhook removes the webhook, if any, so that updates can be
+// retrieved with getUpdates again. If dropPendingUpdates is set, all
+// pending updates are dropped.
+func (api *TelegramBotAPI) DeleteWebhook(dropPendingUpdates bool) error {
+	return api.DeleteWebhookContext(context.Background(), dropPendingUpdates)
 }
 
-func (api *TelegramBotAPI) removeWebhook() error {
-	req := outgoingSetWebhook{
-		URL: "",
+// DeleteWebhookContext is like DeleteWebhook, but uses the provided context
+// for the request.
+func (api *TelegramBotAPI) DeleteWebhookContext(ctx context.Context, dropPendingUpdates bool) error {
+	req := outgoingDeleteWebhook{
+		DropPendingUpdates: dropPendingUpdates,
 	}
-	resp := &baseResponse{}
+	return api.c.postJSON(ctx, deleteWebhook, &baseResponse{}, req)
+}
+
+// GetWebhookInfo returns the current status of the webhook, including the
+// number of pending updates and the last delivery error.
+// If no webhook is set, the URL is empty.
+func (api *TelegramBotAPI) GetWebhookInfo() (*WebhookInfoResponse, error) {
+	return api.GetWebhookInfoContext(context.Background())
+}
+
+// GetWebhookInfoContext is like GetWebhookInfo, but uses the provided
+// context for the request.
+func (api *TelegramBotAPI) GetWebhookInfoContext(ctx context.Context) (*WebhookInfoResponse, error) {
+	resp := &WebhookInfoResponse{}
+	err := api.c.get(ctx, getWebhookInfo, resp)
 
-	_, err := api.c.postJSON(setWebhook, resp, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return check(resp)
+	return resp, nil
 }
 
 // GetMe returns basic information about the bot in form of a UserResponse.
 func (api *TelegramBotAPI) GetMe() (*UserResponse, error) {
+	return api.GetMeContext(context.Background())
+}
+
+// GetMeContext is like GetMe, but uses the provided context for the
+// request.
+func (api *TelegramBotAPI) GetMeContext(ctx context.Context) (*UserResponse, error) {
 	resp := &UserResponse{}
-	_, err := api.c.get(getMe, resp)
+	err := api.c.get(ctx, getMe, resp)
 
-	if err != nil {
-		return nil, err
-	}
-	err = check(&resp.baseResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -282,13 +549,32 @@ func (api *TelegramBotAPI) GetMe() (*UserResponse, error) {
 // https://api.telegram.org/file/bot<token>/<file_path>, where <file_path>
 // is taken from the response.
 func (api *TelegramBotAPI) GetFile(fileID string) (*FileResponse, error) {
+	return api.GetFileContext(context.Background(), fileID)
+}
+
+// GetFileContext is like GetFile, but uses the provided context for the
+// request.
+func (api *TelegramBotAPI) GetFileContext(ctx context.Context, fileID string) (*FileResponse, error) {
 	resp := &FileResponse{}
-	_, err := api.c.getQuerystring(getFile, resp, map[string]string{"file_id": fileID})
+	err := api.c.getQuerystring(ctx, getFile, resp, map[string]string{"file_id": fileID})
 
 	if err != nil {
 		return nil, err
 	}
-	err = check(&resp.baseResponse)
+	return resp, nil
+}
+
+// GetChatMember returns information about a member of a chat.
+func (api *TelegramBotAPI) GetChatMember(chat Recipient, userID int) (*ChatMemberResponse, error) {
+	return api.GetChatMemberContext(context.Background(), chat, userID)
+}
+
+// GetChatMemberContext is like GetChatMember, but uses the provided context
+// for the request.
+func (api *TelegramBotAPI) GetChatMemberContext(ctx context.Context, chat Recipient, userID int) (*ChatMemberResponse, error) {
+	resp := &ChatMemberResponse{}
+	err := api.c.postJSON(ctx, getChatMember, resp, outgoingGetChatMember{Recipient: chat, UserID: userID})
+
 	if err != nil {
 		return nil, err
 	}
@@ -300,131 +586,99 @@ func check(br *baseResponse) error {
 		return nil
 	}
 
-	return fmt.Errorf("tbotapi: API error: %d - %s", br.ErrorCode, br.Description)
+	return &APIError{
+		ErrorCode:   br.ErrorCode,
+		Description: br.Description,
+		Parameters:  br.Parameters,
+	}
+}
+
+func (api *TelegramBotAPI) send(ctx context.Context, s sendable) (*MessageResponse, error) {
+	if api.flood == nil {
+		return api.sendOnce(ctx, s)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := api.flood.wait(ctx, s.recipient())
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := api.sendOnce(ctx, s)
+		var apiErr *APIError
+		if attempt >= api.flood.limits.MaxRetries || !errors.As(err, &apiErr) || apiErr.ErrorCode != 429 || !replayable(s) {
+			return resp, err
+		}
+
+		api.flood.backoff(s.recipient(), apiErr.RetryAfter())
+	}
 }
 
-// ErrNoFileSpecified is returned in case neither a file name + io.Reader
-// nor a fileID were specified.
-var ErrNoFileSpecified = errors.New("tbotapi: Neither a fileID nor a fileName/reader were specified")
+// replayable checks whether s can be sent more than once, which is not the
+// case for uploads from an io.Reader.
+func replayable(s sendable) bool {
+	if f, ok := s.(interface {
+		isUpload() bool
+	}); ok {
+		return !f.isUpload()
+	}
+	return true
+}
 
-func (api *TelegramBotAPI) send(s sendable) (resp *MessageResponse, err error) {
+func (api *TelegramBotAPI) sendOnce(ctx context.Context, s sendable) (resp *MessageResponse, err error) {
 	resp = &MessageResponse{}
 
 	switch s := s.(type) {
 	case *OutgoingMessage:
-		_, err = api.c.postJSON(sendMessage, resp, s)
+		err = api.c.postJSON(ctx, sendMessage, resp, s)
 	case *OutgoingLocation:
-		_, err = api.c.postJSON(sendLocation, resp, s)
+		err = api.c.postJSON(ctx, sendLocation, resp, s)
 	case *OutgoingVenue:
-		_, err = api.c.postJSON(sendVenue, resp, s)
+		err = api.c.postJSON(ctx, sendVenue, resp, s)
 	case *OutgoingForward:
-		_, err = api.c.postJSON(forwardMessage, resp, s)
+		err = api.c.postJSON(ctx, forwardMessage, resp, s)
 	case *OutgoingVideo:
-		if !s.valid() {
-			return nil, ErrNoFileSpecified
-		}
-		if s.isUpload() {
-			_, err = api.c.uploadFile(sendVideo, resp, file{fieldName: "video", fileName: s.fileName, r: s.r}, s)
-		} else {
-			toSend := struct {
-				OutgoingVideo
-				Video string `json:"video"`
-			}{
-				OutgoingVideo: *s,
-				Video:         s.fileID,
-			}
-			_, err = api.c.postJSON(sendVideo, resp, toSend)
-		}
+		err = api.sendFile(ctx, sendVideo, resp, "video", s.outgoingFileBase, &s.outgoingThumbnailBase, s)
 	case *OutgoingPhoto:
-		if !s.valid() {
-			return nil, ErrNoFileSpecified
-		}
-		if s.isUpload() {
-			_, err = api.c.uploadFile(sendPhoto, resp, file{fieldName: "photo", fileName: s.fileName, r: s.r}, s)
-		} else {
-			toSend := struct {
-				OutgoingPhoto
-				Photo string `json:"photo"`
-			}{
-				OutgoingPhoto: *s,
-				Photo:         s.fileID,
-			}
-			_, err = api.c.postJSON(sendPhoto, resp, toSend)
-		}
+		err = api.sendFile(ctx, sendPhoto, resp, "photo", s.outgoingFileBase, nil, s)
 	case *OutgoingVoice:
-		if !s.valid() {
-			return nil, ErrNoFileSpecified
-		}
-		if s.isUpload() {
-			_, err = api.c.uploadFile(sendVoice, resp, file{fieldName: "audio", fileName: s.fileName, r: s.r}, s)
-		} else {
-			toSend := struct {
-				OutgoingVoice
-				Audio string `json:"audio"`
-			}{
-				OutgoingVoice: *s,
-				Audio:         s.fileID,
-			}
-			_, err = api.c.postJSON(sendVoice, resp, toSend)
-		}
+		err = api.sendFile(ctx, sendVoice, resp, "voice", s.outgoingFileBase, nil, s)
 	case *OutgoingAudio:
-		if !s.valid() {
-			return nil, ErrNoFileSpecified
-		}
-		if s.isUpload() {
-			_, err = api.c.uploadFile(sendAudio, resp, file{fieldName: "audio", fileName: s.fileName, r: s.r}, s)
-		} else {
-			toSend := struct {
-				OutgoingAudio
-				Audio string `json:"audio"`
-			}{
-				OutgoingAudio: *s,
-				Audio:         s.fileID,
-			}
-			_, err = api.c.postJSON(sendAudio, resp, toSend)
-		}
+		err = api.sendFile(ctx, sendAudio, resp, "audio", s.outgoingFileBase, &s.outgoingThumbnailBase, s)
 	case *OutgoingDocument:
-		if !s.valid() {
-			return nil, ErrNoFileSpecified
-		}
-		if s.isUpload() {
-			_, err = api.c.uploadFile(sendDocument, resp, file{fieldName: "document", fileName: s.fileName, r: s.r}, s)
-		} else {
-			toSend := struct {
-				OutgoingDocument
-				Document string `json:"document"`
-			}{
-				OutgoingDocument: *s,
-				Document:         s.fileID,
-			}
-			_, err = api.c.postJSON(sendDocument, resp, toSend)
-		}
+		err = api.sendFile(ctx, sendDocument, resp, "document", s.outgoingFileBase, &s.outgoingThumbnailBase, s)
 	case *OutgoingSticker:
-		if !s.valid() {
-			return nil, ErrNoFileSpecified
-		}
-		if s.isUpload() {
-			_, err = api.c.uploadFile(sendSticker, resp, file{fieldName: "sticker", fileName: s.fileName, r: s.r}, s)
-		} else {
-			toSend := struct {
-				OutgoingSticker
-				Sticker string `json:"sticker"`
-			}{
-				OutgoingSticker: *s,
-				Sticker:         s.fileID,
-			}
-			_, err = api.c.postJSON(sendSticker, resp, toSend)
-		}
+		err = api.sendFile(ctx, sendSticker, resp, "sticker", s.outgoingFileBase, nil, s)
 	default:
 		panic(fmt.Sprintf("tbotapi: internal: unexpected type for send(): %T", s))
 	}
 
-	if err != nil {
-		return nil, err
-	}
-	err = check(&resp.baseResponse)
 	if err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
+
+// sendFile sends a file-like message.
+// If the file or its thumbnail are uploaded, the request is sent as
+// multipart/form-data, otherwise as a form.
+func (api *TelegramBotAPI) sendFile(ctx context.Context, m method, resp *MessageResponse, fieldName string, f outgoingFileBase, thumb *outgoingThumbnailBase, q querystringer) error {
+	if !f.valid() {
+		return ErrNoFileSpecified
+	}
+
+	fields := q.querystring()
+	files := f.files(fields, fieldName)
+	if thumb != nil {
+		var err error
+		files, err = thumb.thumbnailFiles(fields, files)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(files) == 0 {
+		return api.c.postForm(ctx, m, resp, fields)
+	}
+	return api.c.uploadFile(ctx, m, resp, files, fields)
+}
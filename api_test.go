@@ -0,0 +1,56 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+func TestShutdownConfirmsReceivedUpdatesOnly(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	user := tbotapi.User{ID: 1, FirstName: "User"}
+	const n, read = 20, 3
+	for i := 0; i < n; i++ {
+		s.AddText(tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}, user, "hello")
+	}
+
+	api, err := s.NewBot(tbotapi.WithUpdatesBuffer(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive(t, api, read)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(api.Updates) < n-read {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d updates buffered, want %d", len(api.Updates), n-read)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := api.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.PendingUpdates(); got != n-read {
+		t.Errorf("%d updates pending at the server, want the %d not received", got, n-read)
+	}
+
+	// The buffered updates can still be read after Shutdown.
+	buffered := 0
+	for range api.Updates {
+		buffered++
+	}
+	if buffered != n-read {
+		t.Errorf("read %d buffered updates after Shutdown, want %d", buffered, n-read)
+	}
+}
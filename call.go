@@ -0,0 +1,107 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Params are the parameters for a call to an arbitrary method, see Call.
+//
+// Values of type InputFile are uploaded as multipart/form-data if they
+// were created by FromReader. Strings are passed as they are, all other
+// values are encoded as JSON.
+type Params map[string]interface{}
+
+// fields converts the params to form fields and files to be uploaded.
+func (p Params) fields() (querystring, []file, error) {
+	fields := querystring{}
+	var files []file
+
+	for k, v := range p {
+		switch v := v.(type) {
+		case InputFile:
+			if !v.valid() {
+				return nil, nil, ErrNoFileSpecified
+			}
+			files = addFile(fields, files, k, v, nil)
+		case *InputFile:
+			if !v.valid() {
+				return nil, nil, ErrNoFileSpecified
+			}
+			files = addFile(fields, files, k, *v, nil)
+		case string:
+			fields[k] = v
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// Strings, like channel recipients, must not be quoted.
+			var str string
+			if json.Unmarshal(b, &str) == nil {
+				fields[k] = str
+			} else {
+				fields[k] = string(b)
+			}
+		}
+	}
+
+	return fields, files, nil
+}
+
+// callResponse represents the response of an arbitrary method.
+type callResponse struct {
+	baseResponse
+	Result json.RawMessage `json:"result"`
+}
+
+// Call calls an arbitrary Bot API method, for example one this library
+// does not wrap yet.
+//
+// params can be nil, Params, which supports uploading files, or any other
+// value, which is sent encoded as JSON.
+// On success, the result of the call is decoded into result, unless it is
+// nil.
+// Errors are returned the same way as for all other calls, i.e. as
+// *APIError or *TransportError.
+func (api *TelegramBotAPI) Call(ctx context.Context, methodName string, params interface{}, result interface{}) error {
+	m := method(methodName)
+	resp := &callResponse{}
+
+	var err error
+	switch params := params.(type) {
+	case nil:
+		err = api.c.get(ctx, m, resp)
+	case Params:
+		var (
+			fields querystring
+			files  []file
+		)
+		fields, files, err = params.fields()
+		if err != nil {
+			return err
+		}
+
+		if len(files) == 0 {
+			err = api.c.postForm(ctx, m, resp, fields)
+		} else {
+			err = api.c.uploadFile(ctx, m, resp, files, fields)
+		}
+	default:
+		err = api.c.postJSON(ctx, m, resp, params)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
@@ -0,0 +1,147 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// KeyType is the type of key a certificate is generated with.
+type KeyType int
+
+// Key types.
+const (
+	ECDSAKey KeyType = iota // ECDSA with the P-256 curve.
+	RSAKey                  // RSA with 2048 bits.
+)
+
+// DefaultCertificateValidity is the default validity of generated
+// certificates.
+const DefaultCertificateValidity = 365 * 24 * time.Hour
+
+// CertificateConfig configures GenerateCertificate.
+type CertificateConfig struct {
+	// KeyType is the type of key to generate. Defaults to ECDSAKey.
+	KeyType KeyType
+
+	// Validity is how long the certificate is valid, starting now.
+	// Defaults to DefaultCertificateValidity.
+	Validity time.Duration
+}
+
+// A Certificate is a self-signed certificate and its private key, both
+// PEM-encoded.
+type Certificate struct {
+	CertPEM []byte // The public part, to be uploaded with SetWebhook.
+	KeyPEM  []byte // The private key, to be kept secret.
+}
+
+// GenerateCertificate generates a self-signed certificate for a webhook
+// served at host, which is a domain name or an IP address, without a port.
+// The common name of the certificate is set to host, as required by the
+// API.
+func GenerateCertificate(host string, cfg CertificateConfig) (*Certificate, error) {
+	if host == "" {
+		return nil, errors.New("tbotapi: no host given for certificate")
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return nil, errors.New("tbotapi: host for certificate must not contain a port")
+	}
+	if cfg.Validity <= 0 {
+		cfg.Validity = DefaultCertificateValidity
+	}
+
+	var (
+		key crypto.Signer
+		err error
+	)
+	keyUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	switch cfg.KeyType {
+	case ECDSAKey:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSAKey:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	default:
+		return nil, errors.New("tbotapi: unknown key type")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             now.Add(-time.Hour), // Allow for clock skew.
+		NotAfter:              now.Add(cfg.Validity),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true, // Self-signed, it is its own issuer.
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificate{
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// WriteFiles writes the certificate and the private key to the given
+// files, for example for WebhookServer.ListenAndServeTLS.
+// The key file is only readable by the owner.
+func (c *Certificate) WriteFiles(certFile, keyFile string) error {
+	err := os.WriteFile(certFile, c.CertPEM, 0644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, c.KeyPEM, 0600)
+}
+
+// TLSCertificate returns the certificate for use in a tls.Config, to serve
+// the webhook without writing files.
+func (c *Certificate) TLSCertificate() (tls.Certificate, error) {
+	return tls.X509KeyPair(c.CertPEM, c.KeyPEM)
+}
+
+// InputFile returns the public part of the certificate as an upload, for
+// WebhookParams.Certificate.
+func (c *Certificate) InputFile() *InputFile {
+	f := FromReader("certificate.pem", bytes.NewReader(c.CertPEM))
+	return &f
+}
@@ -0,0 +1,214 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+)
+
+// parsePEM decodes the single PEM block of the given type in b.
+func parsePEM(t *testing.T, b []byte, typ string) []byte {
+	t.Helper()
+
+	block, rest := pem.Decode(b)
+	if block == nil || block.Type != typ {
+		t.Fatalf("no %s PEM block in %q", typ, b)
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		t.Fatalf("trailing data after %s PEM block: %q", typ, rest)
+	}
+	return block.Bytes
+}
+
+func TestGenerateCertificate(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		cfg      tbotapi.CertificateConfig
+		validity time.Duration
+	}{
+		{"hostname with defaults", "bot.example.com", tbotapi.CertificateConfig{}, tbotapi.DefaultCertificateValidity},
+		{"IPv4 with RSA", "203.0.113.7", tbotapi.CertificateConfig{KeyType: tbotapi.RSAKey, Validity: 24 * time.Hour}, 24 * time.Hour},
+		{"IPv6 with ECDSA", "2001:db8::1", tbotapi.CertificateConfig{KeyType: tbotapi.ECDSAKey, Validity: time.Hour}, time.Hour},
+	}
+
+	for _, tt := range tests {
+		start := time.Now().Truncate(time.Second)
+		c, err := tbotapi.GenerateCertificate(tt.host, tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		end := time.Now()
+
+		cert, err := x509.ParseCertificate(parsePEM(t, c.CertPEM, "CERTIFICATE"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(parsePEM(t, c.KeyPEM, "PRIVATE KEY"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		switch tt.cfg.KeyType {
+		case tbotapi.ECDSAKey:
+			k, ok := key.(*ecdsa.PrivateKey)
+			if !ok || cert.PublicKeyAlgorithm != x509.ECDSA || !k.PublicKey.Equal(cert.PublicKey) {
+				t.Errorf("%s: key %T does not match the ECDSA certificate", tt.name, key)
+			}
+		case tbotapi.RSAKey:
+			k, ok := key.(*rsa.PrivateKey)
+			if !ok || cert.PublicKeyAlgorithm != x509.RSA || !k.PublicKey.Equal(cert.PublicKey) {
+				t.Errorf("%s: key %T does not match the RSA certificate", tt.name, key)
+			} else if k.N.BitLen() != 2048 {
+				t.Errorf("%s: RSA key with %d bits, want 2048", tt.name, k.N.BitLen())
+			}
+		}
+
+		if cert.Subject.CommonName != tt.host {
+			t.Errorf("%s: common name = %q, want %q", tt.name, cert.Subject.CommonName, tt.host)
+		}
+		if ip := net.ParseIP(tt.host); ip != nil {
+			if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(ip) || len(cert.DNSNames) != 0 {
+				t.Errorf("%s: SANs = %v %v, want the IP address only", tt.name, cert.IPAddresses, cert.DNSNames)
+			}
+		} else if len(cert.DNSNames) != 1 || cert.DNSNames[0] != tt.host || len(cert.IPAddresses) != 0 {
+			t.Errorf("%s: SANs = %v %v, want the DNS name only", tt.name, cert.IPAddresses, cert.DNSNames)
+		}
+		if err := cert.VerifyHostname(tt.host); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		// The certificate is backdated by an hour to allow for clock skew.
+		if cert.NotBefore.Before(start.Add(-time.Hour)) || cert.NotBefore.After(end.Add(-time.Hour)) {
+			t.Errorf("%s: valid from %v, want an hour before %v", tt.name, cert.NotBefore, start)
+		}
+		if cert.NotAfter.Before(start.Add(tt.validity)) || cert.NotAfter.After(end.Add(tt.validity)) {
+			t.Errorf("%s: valid until %v, want %v after %v", tt.name, cert.NotAfter, tt.validity, start)
+		}
+
+		if err := cert.CheckSignatureFrom(cert); err != nil {
+			t.Errorf("%s: not self-signed: %v", tt.name, err)
+		}
+	}
+}
+
+func TestGenerateCertificateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		cfg  tbotapi.CertificateConfig
+	}{
+		{"no host", "", tbotapi.CertificateConfig{}},
+		{"host with port", "bot.example.com:8443", tbotapi.CertificateConfig{}},
+		{"IPv6 with port", "[2001:db8::1]:8443", tbotapi.CertificateConfig{}},
+		{"unknown key type", "bot.example.com", tbotapi.CertificateConfig{KeyType: tbotapi.KeyType(42)}},
+	}
+
+	for _, tt := range tests {
+		if c, err := tbotapi.GenerateCertificate(tt.host, tt.cfg); err == nil {
+			t.Errorf("%s: got certificate %v, want error", tt.name, c)
+		}
+	}
+}
+
+func TestCertificateWriteFiles(t *testing.T) {
+	c, err := tbotapi.GenerateCertificate("127.0.0.1", tbotapi.CertificateConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := c.WriteFiles(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []struct {
+		path    string
+		content []byte
+		mode    os.FileMode
+	}{
+		{certFile, c.CertPEM, 0644},
+		{keyFile, c.KeyPEM, 0600},
+	} {
+		b, err := os.ReadFile(f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, f.content) {
+			t.Errorf("%s: content differs", filepath.Base(f.path))
+		}
+		fi, err := os.Stat(f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The umask may remove permissions, but never add any.
+		if runtime.GOOS != "windows" && fi.Mode().Perm()&^f.mode != 0 {
+			t.Errorf("%s: mode %v, want at most %v", filepath.Base(f.path), fi.Mode().Perm(), f.mode)
+		}
+	}
+
+	fromFiles, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inMemory, err := c.TLSCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromFiles.Certificate) != 1 || len(inMemory.Certificate) != 1 || !bytes.Equal(fromFiles.Certificate[0], inMemory.Certificate[0]) {
+		t.Error("certificates from files and from memory differ")
+	}
+}
+
+func TestCertificateTLS(t *testing.T) {
+	for _, keyType := range []tbotapi.KeyType{tbotapi.ECDSAKey, tbotapi.RSAKey} {
+		c, err := tbotapi.GenerateCertificate("127.0.0.1", tbotapi.CertificateConfig{KeyType: keyType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsCert, err := c.TLSCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}))
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+		srv.StartTLS()
+
+		// Clients trusting the uploaded certificate accept the server.
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CertPEM) {
+			t.Fatal("certificate not accepted by the pool")
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Errorf("key type %d: %v", keyType, err)
+		} else {
+			resp.Body.Close()
+		}
+
+		srv.Close()
+	}
+}
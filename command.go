@@ -0,0 +1,164 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// A Command is a bot command a message starts with, like
+// "/start@my_bot some arguments".
+type Command struct {
+	Name     string // The name of the command, without the slash, e.g. "start".
+	Username string // The bot the command is addressed to, e.g. "my_bot". May be empty.
+	Args     string // The raw arguments, without leading whitespace.
+}
+
+// ErrUnterminatedQuote is returned by SplitArgs for arguments with an
+// unterminated quote.
+var ErrUnterminatedQuote = errors.New("tbotapi: unterminated quote in arguments")
+
+// Command returns the bot command the text or the caption of the message
+// starts with.
+//
+// The command is taken from the bot_command entity at offset zero. If the
+// message carries no entities at all, the text itself is parsed.
+// Commands addressed to any bot are returned, see
+// TelegramBotAPI.Command to get only commands for the own bot.
+func (m *Message) Command() (Command, bool) {
+	if m.Text != nil {
+		return parseCommand(*m.Text, m.Entities)
+	} else if m.Caption != nil {
+		return parseCommand(*m.Caption, m.CaptionEntities)
+	}
+	return Command{}, false
+}
+
+// Command returns the bot command the message starts with, if it is
+// addressed to this bot. Commands without a username are always addressed
+// to this bot, commands for other bots, like /start@other_bot in group
+// chats, are ignored.
+func (api *TelegramBotAPI) Command(m *Message) (Command, bool) {
+	c, ok := m.Command()
+	if !ok || !c.IsFor(api.Username) {
+		return Command{}, false
+	}
+	return c, true
+}
+
+// IsFor checks whether the command is addressed to the bot with the given
+// username, i.e. whether it is addressed to no bot in particular or to that
+// one.
+func (c Command) IsFor(username string) bool {
+	return c.Username == "" || strings.EqualFold(c.Username, username)
+}
+
+// Fields splits the arguments like a shell would, see SplitArgs.
+func (c Command) Fields() ([]string, error) {
+	return SplitArgs(c.Args)
+}
+
+func parseCommand(text string, entities *[]MessageEntity) (Command, bool) {
+	var raw, rest string
+	if entities != nil {
+		var e *MessageEntity
+		for i := range *entities {
+			if (*entities)[i].Type == EntityTypeBotCommand && (*entities)[i].Offset == 0 {
+				e = &(*entities)[i]
+				break
+			}
+		}
+		if e == nil {
+			return Command{}, false
+		}
+
+		// Entity offsets and lengths are measured in UTF-16 code units.
+		units := utf16.Encode([]rune(text))
+		if e.Length < 2 || e.Length > len(units) {
+			return Command{}, false
+		}
+		raw = string(utf16.Decode(units[:e.Length]))
+		rest = string(utf16.Decode(units[e.Length:]))
+	} else {
+		if !strings.HasPrefix(text, "/") {
+			return Command{}, false
+		}
+		raw = text
+		if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+			raw, rest = text[:i], text[i:]
+		}
+	}
+
+	c := Command{
+		Name: strings.TrimPrefix(raw, "/"),
+		Args: strings.TrimLeftFunc(rest, unicode.IsSpace),
+	}
+	if i := strings.Index(c.Name, "@"); i >= 0 {
+		c.Name, c.Username = c.Name[:i], c.Name[i+1:]
+	}
+	if c.Name == "" {
+		return Command{}, false
+	}
+
+	return c, true
+}
+
+// SplitArgs splits s into arguments separated by whitespace.
+// Like in a shell, arguments can be quoted with single or double quotes to
+// contain whitespace, and a backslash escapes the next character outside of
+// single quotes.
+func SplitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, ErrUnterminatedQuote
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mrd0ll4r/tbotapi"
+)
+
+// commandEntity returns a bot_command entity.
+func commandEntity(offset, length int) tbotapi.MessageEntity {
+	return tbotapi.MessageEntity{Type: tbotapi.EntityTypeBotCommand, Offset: offset, Length: length}
+}
+
+func TestMessageCommand(t *testing.T) {
+	url := tbotapi.MessageEntity{Type: tbotapi.EntityTypeURL, Offset: 0, Length: 6}
+
+	tests := []struct {
+		name     string
+		text     string
+		entities []tbotapi.MessageEntity // nil for a message without entities.
+		want     tbotapi.Command
+		ok       bool
+	}{
+		{"plain", "/start", nil, tbotapi.Command{Name: "start"}, true},
+		{"arguments", "/echo  hello world ", nil, tbotapi.Command{Name: "echo", Args: "hello world "}, true},
+		{"newline", "/echo\nhello", nil, tbotapi.Command{Name: "echo", Args: "hello"}, true},
+		{"username", "/start@my_bot", nil, tbotapi.Command{Name: "start", Username: "my_bot"}, true},
+		{"username and arguments", "/start@my_bot deep-link", nil, tbotapi.Command{Name: "start", Username: "my_bot", Args: "deep-link"}, true},
+		{"no command", "hello /start", nil, tbotapi.Command{}, false},
+		{"slash only", "/", nil, tbotapi.Command{}, false},
+		{"username only", "/@my_bot", nil, tbotapi.Command{}, false},
+
+		{"entity", "/start", []tbotapi.MessageEntity{commandEntity(0, 6)}, tbotapi.Command{Name: "start"}, true},
+		{"entity with username", "/start@my_bot now", []tbotapi.MessageEntity{commandEntity(0, 13)}, tbotapi.Command{Name: "start", Username: "my_bot", Args: "now"}, true},
+		{"entity shorter than the word", "/start-now", []tbotapi.MessageEntity{commandEntity(0, 6)}, tbotapi.Command{Name: "start", Args: "-now"}, true},
+		{"entity after other entities", "/start", []tbotapi.MessageEntity{url, commandEntity(0, 6)}, tbotapi.Command{Name: "start"}, true},
+		{"entity not at the start", "hi /start", []tbotapi.MessageEntity{commandEntity(3, 6)}, tbotapi.Command{}, false},
+		{"no command entity", "/start", []tbotapi.MessageEntity{url}, tbotapi.Command{}, false},
+		{"empty entities", "/start", []tbotapi.MessageEntity{}, tbotapi.Command{}, false},
+		{"entity too short", "/start", []tbotapi.MessageEntity{commandEntity(0, 1)}, tbotapi.Command{}, false},
+		{"entity too long", "/start", []tbotapi.MessageEntity{commandEntity(0, 7)}, tbotapi.Command{}, false},
+
+		// Offsets and lengths are measured in UTF-16 code units, in which
+		// characters outside the BMP take two units.
+		{"non-BMP before the command", "😀 /start", []tbotapi.MessageEntity{commandEntity(3, 6)}, tbotapi.Command{}, false},
+		{"non-BMP without entities", "😀/start", nil, tbotapi.Command{}, false},
+		{"non-BMP arguments", "/say 😀 hi", []tbotapi.MessageEntity{commandEntity(0, 4)}, tbotapi.Command{Name: "say", Args: "😀 hi"}, true},
+		{"non-BMP in the command", "/😀go now", []tbotapi.MessageEntity{commandEntity(0, 5)}, tbotapi.Command{Name: "😀go", Args: "now"}, true},
+		{"non-BMP counted twice", "/😀go", []tbotapi.MessageEntity{commandEntity(0, 4)}, tbotapi.Command{Name: "😀g", Args: "o"}, true},
+		{"non-BMP length past the end", "/😀", []tbotapi.MessageEntity{commandEntity(0, 4)}, tbotapi.Command{}, false},
+	}
+
+	for _, tt := range tests {
+		var entities *[]tbotapi.MessageEntity
+		if tt.entities != nil {
+			entities = &tt.entities
+		}
+		text := tt.text
+
+		m := tbotapi.Message{}
+		m.Text, m.Entities = &text, entities
+		got, ok := m.Command()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Command() = %+v, %t, want %+v, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+
+		m = tbotapi.Message{}
+		m.Caption, m.CaptionEntities = &text, entities
+		got, ok = m.Command()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Command() of caption = %+v, %t, want %+v, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if c, ok := (&tbotapi.Message{}).Command(); ok {
+		t.Errorf("Command() of message without text = %+v", c)
+	}
+}
+
+func TestCommandIsFor(t *testing.T) {
+	tests := []struct {
+		command  string
+		username string
+		want     bool
+	}{
+		{"/start", "my_bot", true},
+		{"/start@my_bot", "my_bot", true},
+		{"/start@My_Bot", "my_bot", true},
+		{"/start@other_bot", "my_bot", false},
+		{"/start@my_bot_2", "my_bot", false},
+	}
+
+	for _, tt := range tests {
+		m := tbotapi.Message{}
+		m.Text = &tt.command
+
+		c, ok := m.Command()
+		if !ok {
+			t.Fatalf("%s: no command", tt.command)
+		}
+		if got := c.IsFor(tt.username); got != tt.want {
+			t.Errorf("%s: IsFor(%q) = %t, want %t", tt.command, tt.username, got, tt.want)
+		}
+
+		api := &tbotapi.TelegramBotAPI{Username: tt.username}
+		if _, ok := api.Command(&m); ok != tt.want {
+			t.Errorf("%s: TelegramBotAPI.Command() ok = %t, want %t", tt.command, ok, tt.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  error
+	}{
+		{``, nil, nil},
+		{`   `, nil, nil},
+		{`a b  c`, []string{"a", "b", "c"}, nil},
+		{" a\tb\n", []string{"a", "b"}, nil},
+		{`"a b" c`, []string{"a b", "c"}, nil},
+		{`'a b' c`, []string{"a b", "c"}, nil},
+		{`a"b c"d`, []string{"ab cd"}, nil},
+		{`"" ''`, []string{"", ""}, nil},
+		{`"it's" 'say "hi"'`, []string{"it's", `say "hi"`}, nil},
+		{`a\ b c`, []string{"a b", "c"}, nil},
+		{`\"a b\"`, []string{`"a`, `b"`}, nil},
+		{`"a \" b"`, []string{`a " b`}, nil},
+		{`'a \' b`, []string{`a \`, "b"}, nil},
+		{`'a \ b'`, []string{`a \ b`}, nil},
+		{`a\\b`, []string{`a\b`}, nil},
+		{`a\`, []string{`a\`}, nil},
+		{`\`, []string{`\`}, nil},
+		{`😀 "😀 😀"`, []string{"😀", "😀 😀"}, nil},
+		{`"a b`, nil, tbotapi.ErrUnterminatedQuote},
+		{`a 'b`, nil, tbotapi.ErrUnterminatedQuote},
+		{`"a' b`, nil, tbotapi.ErrUnterminatedQuote},
+	}
+
+	for _, tt := range tests {
+		got, err := tbotapi.SplitArgs(tt.in)
+		if !errors.Is(err, tt.err) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+
+	m := tbotapi.Message{}
+	text := `/echo "hello world" again`
+	m.Text = &text
+	c, _ := m.Command()
+	fields, err := c.Fields()
+	if err != nil || !reflect.DeepEqual(fields, []string{"hello world", "again"}) {
+		t.Errorf("Fields() = %q, %v", fields, err)
+	}
+}
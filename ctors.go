@@ -52,22 +52,16 @@ func (api *TelegramBotAPI) NewOutgoingVenue(recipient Recipient, latitude, longi
 
 // NewOutgoingVideo creates a new outgoing video file.
 func (api *TelegramBotAPI) NewOutgoingVideo(recipient Recipient, fileName string, reader io.Reader) *OutgoingVideo {
-	return &OutgoingVideo{
-		outgoingMessageBase: outgoingMessageBase{
-			outgoingBase: outgoingBase{
-				api:       api,
-				Recipient: recipient,
-			},
-		},
-		outgoingFileBase: outgoingFileBase{
-			fileName: fileName,
-			r:        reader,
-		},
-	}
+	return api.NewOutgoingVideoFile(recipient, FromReader(fileName, reader))
 }
 
 // NewOutgoingVideoResend creates a new outgoing video file for re-sending.
 func (api *TelegramBotAPI) NewOutgoingVideoResend(recipient Recipient, fileID string) *OutgoingVideo {
+	return api.NewOutgoingVideoFile(recipient, FromFileID(fileID))
+}
+
+// NewOutgoingVideoFile creates a new outgoing video file from an InputFile.
+func (api *TelegramBotAPI) NewOutgoingVideoFile(recipient Recipient, file InputFile) *OutgoingVideo {
 	return &OutgoingVideo{
 		outgoingMessageBase: outgoingMessageBase{
 			outgoingBase: outgoingBase{
@@ -76,29 +70,23 @@ func (api *TelegramBotAPI) NewOutgoingVideoResend(recipient Recipient, fileID st
 			},
 		},
 		outgoingFileBase: outgoingFileBase{
-			fileID: fileID,
+			file: file,
 		},
 	}
 }
 
 // NewOutgoingPhoto creates a new outgoing photo.
 func (api *TelegramBotAPI) NewOutgoingPhoto(recipient Recipient, fileName string, reader io.Reader) *OutgoingPhoto {
-	return &OutgoingPhoto{
-		outgoingMessageBase: outgoingMessageBase{
-			outgoingBase: outgoingBase{
-				api:       api,
-				Recipient: recipient,
-			},
-		},
-		outgoingFileBase: outgoingFileBase{
-			fileName: fileName,
-			r:        reader,
-		},
-	}
+	return api.NewOutgoingPhotoFile(recipient, FromReader(fileName, reader))
 }
 
 // NewOutgoingPhotoResend creates a new outgoing photo for re-sending.
 func (api *TelegramBotAPI) NewOutgoingPhotoResend(recipient Recipient, fileID string) *OutgoingPhoto {
+	return api.NewOutgoingPhotoFile(recipient, FromFileID(fileID))
+}
+
+// NewOutgoingPhotoFile creates a new outgoing photo from an InputFile.
+func (api *TelegramBotAPI) NewOutgoingPhotoFile(recipient Recipient, file InputFile) *OutgoingPhoto {
 	return &OutgoingPhoto{
 		outgoingMessageBase: outgoingMessageBase{
 			outgoingBase: outgoingBase{
@@ -107,30 +95,24 @@ func (api *TelegramBotAPI) NewOutgoingPhotoResend(recipient Recipient, fileID st
 			},
 		},
 		outgoingFileBase: outgoingFileBase{
-			fileID: fileID,
+			file: file,
 		},
 	}
 }
 
 // NewOutgoingSticker creates a new outgoing sticker message.
 func (api *TelegramBotAPI) NewOutgoingSticker(recipient Recipient, fileName string, reader io.Reader) *OutgoingSticker {
-	return &OutgoingSticker{
-		outgoingMessageBase: outgoingMessageBase{
-			outgoingBase: outgoingBase{
-				api:       api,
-				Recipient: recipient,
-			},
-		},
-		outgoingFileBase: outgoingFileBase{
-			fileName: fileName,
-			r:        reader,
-		},
-	}
+	return api.NewOutgoingStickerFile(recipient, FromReader(fileName, reader))
 }
 
 // NewOutgoingStickerResend creates a new outgoing sticker message for
 // re-sending.
 func (api *TelegramBotAPI) NewOutgoingStickerResend(recipient Recipient, fileID string) *OutgoingSticker {
+	return api.NewOutgoingStickerFile(recipient, FromFileID(fileID))
+}
+
+// NewOutgoingStickerFile creates a new outgoing sticker message from an InputFile.
+func (api *TelegramBotAPI) NewOutgoingStickerFile(recipient Recipient, file InputFile) *OutgoingSticker {
 	return &OutgoingSticker{
 		outgoingMessageBase: outgoingMessageBase{
 			outgoingBase: outgoingBase{
@@ -139,29 +121,23 @@ func (api *TelegramBotAPI) NewOutgoingStickerResend(recipient Recipient, fileID
 			},
 		},
 		outgoingFileBase: outgoingFileBase{
-			fileID: fileID,
+			file: file,
 		},
 	}
 }
 
 // NewOutgoingVoice creates a new outgoing voice note.
 func (api *TelegramBotAPI) NewOutgoingVoice(recipient Recipient, fileName string, reader io.Reader) *OutgoingVoice {
-	return &OutgoingVoice{
-		outgoingMessageBase: outgoingMessageBase{
-			outgoingBase: outgoingBase{
-				api:       api,
-				Recipient: recipient,
-			},
-		},
-		outgoingFileBase: outgoingFileBase{
-			fileName: fileName,
-			r:        reader,
-		},
-	}
+	return api.NewOutgoingVoiceFile(recipient, FromReader(fileName, reader))
 }
 
 // NewOutgoingVoiceResend creates a new outgoing voice note for re-sending.
 func (api *TelegramBotAPI) NewOutgoingVoiceResend(recipient Recipient, fileID string) *OutgoingVoice {
+	return api.NewOutgoingVoiceFile(recipient, FromFileID(fileID))
+}
+
+// NewOutgoingVoiceFile creates a new outgoing voice note from an InputFile.
+func (api *TelegramBotAPI) NewOutgoingVoiceFile(recipient Recipient, file InputFile) *OutgoingVoice {
 	return &OutgoingVoice{
 		outgoingMessageBase: outgoingMessageBase{
 			outgoingBase: outgoingBase{
@@ -170,29 +146,23 @@ func (api *TelegramBotAPI) NewOutgoingVoiceResend(recipient Recipient, fileID st
 			},
 		},
 		outgoingFileBase: outgoingFileBase{
-			fileID: fileID,
+			file: file,
 		},
 	}
 }
 
 // NewOutgoingAudio creates a new outgoing audio file.
 func (api *TelegramBotAPI) NewOutgoingAudio(recipient Recipient, fileName string, reader io.Reader) *OutgoingAudio {
-	return &OutgoingAudio{
-		outgoingMessageBase: outgoingMessageBase{
-			outgoingBase: outgoingBase{
-				api:       api,
-				Recipient: recipient,
-			},
-		},
-		outgoingFileBase: outgoingFileBase{
-			fileName: fileName,
-			r:        reader,
-		},
-	}
+	return api.NewOutgoingAudioFile(recipient, FromReader(fileName, reader))
 }
 
 // NewOutgoingAudioResend creates a new outgoing audio file for re-sending.
 func (api *TelegramBotAPI) NewOutgoingAudioResend(recipient Recipient, fileID string) *OutgoingAudio {
+	return api.NewOutgoingAudioFile(recipient, FromFileID(fileID))
+}
+
+// NewOutgoingAudioFile creates a new outgoing audio file from an InputFile.
+func (api *TelegramBotAPI) NewOutgoingAudioFile(recipient Recipient, file InputFile) *OutgoingAudio {
 	return &OutgoingAudio{
 		outgoingMessageBase: outgoingMessageBase{
 			outgoingBase: outgoingBase{
@@ -201,29 +171,23 @@ func (api *TelegramBotAPI) NewOutgoingAudioResend(recipient Recipient, fileID st
 			},
 		},
 		outgoingFileBase: outgoingFileBase{
-			fileID: fileID,
+			file: file,
 		},
 	}
 }
 
 // NewOutgoingDocument creates a new outgoing file.
 func (api *TelegramBotAPI) NewOutgoingDocument(recipient Recipient, fileName string, reader io.Reader) *OutgoingDocument {
-	return &OutgoingDocument{
-		outgoingMessageBase: outgoingMessageBase{
-			outgoingBase: outgoingBase{
-				api:       api,
-				Recipient: recipient,
-			},
-		},
-		outgoingFileBase: outgoingFileBase{
-			fileName: fileName,
-			r:        reader,
-		},
-	}
+	return api.NewOutgoingDocumentFile(recipient, FromReader(fileName, reader))
 }
 
 // NewOutgoingDocumentResend creates a new outgoing file for re-sending.
 func (api *TelegramBotAPI) NewOutgoingDocumentResend(recipient Recipient, fileID string) *OutgoingDocument {
+	return api.NewOutgoingDocumentFile(recipient, FromFileID(fileID))
+}
+
+// NewOutgoingDocumentFile creates a new outgoing file from an InputFile.
+func (api *TelegramBotAPI) NewOutgoingDocumentFile(recipient Recipient, file InputFile) *OutgoingDocument {
 	return &OutgoingDocument{
 		outgoingMessageBase: outgoingMessageBase{
 			outgoingBase: outgoingBase{
@@ -232,7 +196,7 @@ func (api *TelegramBotAPI) NewOutgoingDocumentResend(recipient Recipient, fileID
 			},
 		},
 		outgoingFileBase: outgoingFileBase{
-			fileID: fileID,
+			file: file,
 		},
 	}
 }
@@ -0,0 +1,298 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Defaults for DispatcherConfig.
+const (
+	DefaultDispatcherWorkers   = 16
+	DefaultDispatcherQueueSize = 1024
+)
+
+// ErrDispatcherStopped is returned by Dispatch after the dispatcher was
+// stopped.
+var ErrDispatcherStopped = errors.New("tbotapi: dispatcher stopped")
+
+// DispatcherConfig configures a Dispatcher.
+type DispatcherConfig struct {
+	// Workers is the number of updates handled concurrently.
+	// Defaults to DefaultDispatcherWorkers.
+	Workers int
+
+	// QueueSize is the maximum number of updates queued or being handled.
+	// Dispatch blocks while the queue is full.
+	// Defaults to DefaultDispatcherQueueSize.
+	QueueSize int
+
+	// Drain makes Run handle all queued updates, and the ones still
+	// buffered in the Updates channel, before it returns.
+	// Otherwise, queued updates that were not started yet are discarded.
+	Drain bool
+
+	// OnError is called by Run with errors received instead of updates.
+	OnError func(err error)
+}
+
+// A Dispatcher handles updates concurrently with a pool of workers.
+//
+// Updates from the same chat are handled strictly in order, one after
+// another. Inline queries, chosen inline results and callback queries are
+// ordered per user instead, even if a callback query belongs to a message
+// in a chat. Updates from different chats or users are handled in
+// parallel.
+type Dispatcher struct {
+	handler HandlerFunc
+	cfg     DispatcherConfig
+
+	slots   chan struct{}   // One per queued or running update.
+	ready   chan updateKey  // Keys with queued updates and no worker.
+	stopped chan struct{}   // Closed once the dispatcher stops accepting updates.
+	ctx     context.Context // Passed to handlers.
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu          sync.Mutex
+	queues      map[updateKey][]dispatchItem
+	scheduled   map[updateKey]bool // Keys that are ready or being handled.
+	outstanding int                // Queued or running updates.
+	stopping    bool
+	readyClosed bool
+}
+
+type dispatchItem struct {
+	api    *TelegramBotAPI
+	update Update
+	ack    func() // Called once the update is handled, may be nil.
+}
+
+// An updateKey identifies the sequence an update belongs to.
+type updateKey struct {
+	kind byte // 'c' for chats, 'u' for users, 'i' for unrelated updates.
+	id   int
+}
+
+func keyOf(u *Update) updateKey {
+	if u.CallbackQuery != nil {
+		return updateKey{'u', u.CallbackQuery.From.ID}
+	} else if c := u.Chat(); c != nil {
+		return updateKey{'c', c.ID}
+	} else if from := u.From(); from != nil {
+		return updateKey{'u', from.ID}
+	}
+	return updateKey{'i', u.ID}
+}
+
+// NewDispatcher creates a new Dispatcher calling h for every update and
+// starts its workers.
+// A Router can be used by passing its HandleUpdate method.
+func NewDispatcher(h HandlerFunc, cfg DispatcherConfig) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultDispatcherWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultDispatcherQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		handler:   h,
+		cfg:       cfg,
+		slots:     make(chan struct{}, cfg.QueueSize),
+		ready:     make(chan updateKey, cfg.QueueSize), // Never more keys than queued updates.
+		stopped:   make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		queues:    make(map[updateKey][]dispatchItem),
+		scheduled: make(map[updateKey]bool),
+	}
+
+	d.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go d.work()
+	}
+
+	return d
+}
+
+// Dispatch queues an update to be handled.
+// It blocks while the queue is full, until ctx is done or the dispatcher
+// is stopped.
+func (d *Dispatcher) Dispatch(ctx context.Context, api *TelegramBotAPI, u Update) error {
+	return d.dispatch(ctx, dispatchItem{api: api, update: u})
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, item dispatchItem) error {
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.stopped:
+		return ErrDispatcherStopped
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopping {
+		<-d.slots
+		return ErrDispatcherStopped
+	}
+
+	k := keyOf(&item.update)
+	d.queues[k] = append(d.queues[k], item)
+	d.outstanding++
+	if !d.scheduled[k] {
+		d.scheduled[k] = true
+		d.ready <- k
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for k := range d.ready {
+		d.mu.Lock()
+		queue := d.queues[k]
+		if len(queue) == 0 {
+			// Discarded by Stop.
+			delete(d.scheduled, k)
+			d.mu.Unlock()
+			continue
+		}
+		item := queue[0]
+		d.queues[k] = queue[1:]
+		d.mu.Unlock()
+
+		d.handler(d.ctx, item.api, item.update)
+		if item.ack != nil {
+			item.ack()
+		}
+
+		d.mu.Lock()
+		<-d.slots
+		d.outstanding--
+		if len(d.queues[k]) > 0 {
+			// Requeue instead of continuing with the same key, so that
+			// one busy chat cannot occupy a worker forever.
+			d.ready <- k
+		} else {
+			delete(d.queues, k)
+			delete(d.scheduled, k)
+		}
+		d.closeIfDone()
+		d.mu.Unlock()
+	}
+}
+
+// closeIfDone lets the workers exit once the dispatcher is stopping and
+// all updates are handled. d.mu must be held.
+func (d *Dispatcher) closeIfDone() {
+	if d.stopping && d.outstanding == 0 && !d.readyClosed {
+		d.readyClosed = true
+		close(d.ready)
+	}
+}
+
+func (d *Dispatcher) stop(discard bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.stopping {
+		d.stopping = true
+		close(d.stopped)
+	}
+	if discard {
+		for k, queue := range d.queues {
+			for range queue {
+				<-d.slots
+				d.outstanding--
+			}
+			d.queues[k] = nil
+		}
+	}
+	d.closeIfDone()
+}
+
+// Shutdown stops accepting updates and waits until all queued updates
+// are handled, or until ctx is done.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.stop(false)
+	return d.wait(ctx)
+}
+
+// Stop stops accepting updates, discards queued updates that were not
+// started yet and waits for the running handlers to return.
+// The context passed to the handlers is canceled.
+func (d *Dispatcher) Stop() {
+	d.stop(true)
+	d.cancel()
+	d.wait(context.Background())
+}
+
+func (d *Dispatcher) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		d.cancel()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run consumes api.Updates and dispatches the updates until api is closed.
+// Then, depending on the configuration, it either waits for all queued
+// updates to be handled or discards them, and returns after all running
+// handlers returned.
+// With Drain set, Run also dispatches the updates still buffered in
+// api.Updates, until the channel is closed and empty.
+func (d *Dispatcher) Run(api *TelegramBotAPI) {
+	defer func() {
+		if d.cfg.Drain {
+			d.Shutdown(context.Background())
+		} else {
+			d.Stop()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !d.cfg.Drain {
+		// Stop waiting for free slots once api is closed.
+		go func() {
+			select {
+			case <-api.closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	for u := range api.Updates {
+		if err := u.Error(); err != nil {
+			if d.cfg.OnError != nil {
+				d.cfg.OnError(err)
+			}
+			continue
+		}
+
+		err := d.dispatch(ctx, dispatchItem{api: api, update: u.Update(), ack: u.ack})
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+func textUpdate(id int, chat tbotapi.Chat, from tbotapi.User) tbotapi.Update {
+	m := tbotapi.Message{}
+	m.Chat = chat
+	m.From = from
+	return tbotapi.Update{ID: id, Message: &m}
+}
+
+// orderRecorder records the updates handled per sequence, and checks that
+// the updates of one sequence are never handled concurrently.
+type orderRecorder struct {
+	t       *testing.T
+	keyOf   func(u tbotapi.Update) string
+	mu      sync.Mutex
+	active  map[string]bool
+	handled map[string][]int
+	running int
+	maxRun  int
+}
+
+func newOrderRecorder(t *testing.T, keyOf func(u tbotapi.Update) string) *orderRecorder {
+	return &orderRecorder{
+		t:       t,
+		keyOf:   keyOf,
+		active:  make(map[string]bool),
+		handled: make(map[string][]int),
+	}
+}
+
+func (r *orderRecorder) handle(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+	k := r.keyOf(u)
+
+	r.mu.Lock()
+	if r.active[k] {
+		r.t.Errorf("update %d of %s handled concurrently with another one", u.ID, k)
+	}
+	r.active[k] = true
+	r.running++
+	if r.running > r.maxRun {
+		r.maxRun = r.running
+	}
+	r.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	r.mu.Lock()
+	r.active[k] = false
+	r.running--
+	r.handled[k] = append(r.handled[k], u.ID)
+	r.mu.Unlock()
+}
+
+func TestDispatcherOrdersPerChat(t *testing.T) {
+	r := newOrderRecorder(t, func(u tbotapi.Update) string {
+		return fmt.Sprintf("chat %d", u.Message.Chat.ID)
+	})
+	d := tbotapi.NewDispatcher(r.handle, tbotapi.DispatcherConfig{Workers: 4, QueueSize: 8})
+
+	const chats, perChat = 4, 25
+	user := tbotapi.User{ID: 1, FirstName: "User"}
+	for i := 0; i < chats*perChat; i++ {
+		chat := tbotapi.Chat{ID: i % chats, Type: tbotapi.PrivateChatType}
+		err := d.Dispatch(context.Background(), nil, textUpdate(i+1, chat, user))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, ids := range r.handled {
+		if len(ids) != perChat {
+			t.Errorf("%s: handled %d updates, want %d", k, len(ids), perChat)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("%s: handled out of order: %v", k, ids)
+				break
+			}
+		}
+	}
+	if r.maxRun < 2 {
+		t.Errorf("updates from different chats were not handled in parallel")
+	}
+}
+
+func TestDispatcherOrdersQueriesPerUser(t *testing.T) {
+	r := newOrderRecorder(t, func(u tbotapi.Update) string {
+		return fmt.Sprintf("user %d", u.From().ID)
+	})
+	d := tbotapi.NewDispatcher(r.handle, tbotapi.DispatcherConfig{Workers: 4})
+
+	// Callback queries of one user belong to messages in different chats,
+	// but must still be ordered with the inline queries of that user.
+	const users, perUser = 3, 20
+	for i := 0; i < users*perUser; i++ {
+		from := tbotapi.User{ID: i % users, FirstName: "User"}
+		u := tbotapi.Update{ID: i + 1}
+		if i%2 == 0 {
+			u.InlineQuery = &tbotapi.InlineQuery{ID: fmt.Sprint(i), From: from}
+		} else {
+			m := textUpdate(0, tbotapi.Chat{ID: 100 + i, Type: tbotapi.GroupChatType}, from).Message
+			u.CallbackQuery = &tbotapi.CallbackQuery{ID: fmt.Sprint(i), From: from, Message: m}
+		}
+
+		if err := d.Dispatch(context.Background(), nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, ids := range r.handled {
+		if len(ids) != perUser {
+			t.Errorf("%s: handled %d updates, want %d", k, len(ids), perUser)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("%s: handled out of order: %v", k, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestDispatcherBoundedQueue(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	d := tbotapi.NewDispatcher(func(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+		started <- struct{}{}
+		<-release
+	}, tbotapi.DispatcherConfig{Workers: 1, QueueSize: 2})
+
+	user := tbotapi.User{ID: 1, FirstName: "User"}
+	for i := 1; i <= 2; i++ {
+		chat := tbotapi.Chat{ID: i, Type: tbotapi.PrivateChatType}
+		if err := d.Dispatch(context.Background(), nil, textUpdate(i, chat, user)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+
+	// One update is running and one is queued, so the queue is full.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := d.Dispatch(ctx, nil, textUpdate(3, tbotapi.Chat{ID: 3}, user))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Dispatch on a full queue returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Finishing one update makes room for another one.
+	release <- struct{}{}
+	<-started
+	if err := d.Dispatch(context.Background(), nil, textUpdate(3, tbotapi.Chat{ID: 3}, user)); err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Dispatch(context.Background(), nil, textUpdate(4, tbotapi.Chat{ID: 4}, user)); err != tbotapi.ErrDispatcherStopped {
+		t.Errorf("Dispatch after Shutdown returned %v, want %v", err, tbotapi.ErrDispatcherStopped)
+	}
+}
+
+func TestDispatcherShutdownAndStop(t *testing.T) {
+	tests := []struct {
+		name  string
+		stop  func(d *tbotapi.Dispatcher)
+		drain bool
+	}{
+		{"Shutdown", func(d *tbotapi.Dispatcher) { d.Shutdown(context.Background()) }, true},
+		{"Stop", (*tbotapi.Dispatcher).Stop, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				handled int
+			)
+			started := make(chan struct{})
+			d := tbotapi.NewDispatcher(func(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+				if u.ID == 1 {
+					close(started)
+				}
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				handled++
+				mu.Unlock()
+			}, tbotapi.DispatcherConfig{Workers: 1})
+
+			const n = 10
+			user := tbotapi.User{ID: 1, FirstName: "User"}
+			for i := 1; i <= n; i++ {
+				if err := d.Dispatch(context.Background(), nil, textUpdate(i, tbotapi.Chat{ID: 1}, user)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			<-started
+			tt.stop(d)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.drain && handled != n {
+				t.Errorf("handled %d updates, want all %d", handled, n)
+			}
+			if !tt.drain && handled == n {
+				t.Errorf("handled all %d updates, want queued ones discarded", n)
+			}
+		})
+	}
+}
+
+func TestDispatcherRunDrainsUpdatesBuffer(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	user := tbotapi.User{ID: 1, FirstName: "User"}
+	const n = 20
+	for i := 0; i < n; i++ {
+		s.AddText(tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}, user, "hello")
+	}
+
+	api, err := s.NewBot(tbotapi.WithUpdatesBuffer(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		handled = make(map[int]int)
+	)
+	started := make(chan struct{}, n)
+	d := tbotapi.NewDispatcher(func(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+		started <- struct{}{}
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		handled[u.ID]++
+		mu.Unlock()
+	}, tbotapi.DispatcherConfig{Workers: 1, QueueSize: 1, Drain: true})
+
+	done := make(chan struct{})
+	go func() {
+		d.Run(api)
+		close(done)
+	}()
+
+	<-started
+	api.Close()
+	<-done
+
+	if len(handled) != n {
+		t.Errorf("handled %d updates, want all %d", len(handled), n)
+	}
+	for id, times := range handled {
+		if times != 1 {
+			t.Errorf("handled update %d %d times, want once", id, times)
+		}
+	}
+}
+
+func TestShutdownWhileDispatching(t *testing.T) {
+	const n = 20
+	chatOf := func(u tbotapi.Update) string {
+		return fmt.Sprintf("chat %d", u.Message.Chat.ID)
+	}
+
+	// start runs a dispatcher with handler h on a new bot, which gets n
+	// updates from two chats.
+	start := func(t *testing.T, h tbotapi.HandlerFunc, cfg tbotapi.DispatcherConfig) (*tbotapitest.Server, *tbotapi.TelegramBotAPI, chan struct{}) {
+		s := tbotapitest.NewServer()
+		t.Cleanup(s.Close)
+
+		user := tbotapi.User{ID: 1, FirstName: "User"}
+		for i := 0; i < n; i++ {
+			s.AddText(tbotapi.Chat{ID: i % 2, Type: tbotapi.PrivateChatType}, user, "hello")
+		}
+
+		api, err := s.NewBot(tbotapi.WithUpdatesBuffer(50))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			tbotapi.NewDispatcher(h, cfg).Run(api)
+			close(done)
+		}()
+		return s, api, done
+	}
+
+	checkOrder := func(t *testing.T, r *orderRecorder) {
+		total := 0
+		for k, ids := range r.handled {
+			total += len(ids)
+			for i := 1; i < len(ids); i++ {
+				if ids[i] <= ids[i-1] {
+					t.Errorf("%s: handled out of order: %v", k, ids)
+					break
+				}
+			}
+		}
+		if total != n {
+			t.Errorf("handled %d updates, want all %d", total, n)
+		}
+	}
+
+	t.Run("blocked", func(t *testing.T) {
+		r := newOrderRecorder(t, chatOf)
+		gate := make(chan struct{})
+		h := func(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+			<-gate
+			r.handle(ctx, api, u)
+		}
+		s, api, done := start(t, h, tbotapi.DispatcherConfig{Workers: 2, QueueSize: 2, Drain: true})
+
+		// Two updates are being handled, and Run waits for a free slot
+		// with the third one, so the other ones stay buffered.
+		const received = 3
+		deadline := time.Now().Add(5 * time.Second)
+		for len(api.Updates) != n-received {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d updates buffered, want %d", len(api.Updates), n-received)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := api.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := s.PendingUpdates(); got != n-received {
+			t.Errorf("%d updates pending at the server, want the %d not received", got, n-received)
+		}
+
+		close(gate)
+		<-done
+		checkOrder(t, r)
+	})
+
+	t.Run("running", func(t *testing.T) {
+		r := newOrderRecorder(t, chatOf)
+		s, api, done := start(t, r.handle, tbotapi.DispatcherConfig{Workers: 2, QueueSize: 2, Drain: true})
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			r.mu.Lock()
+			handled := len(r.handled)
+			r.mu.Unlock()
+			if handled > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("no update handled")
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		r.mu.Lock()
+		handled := 0
+		for _, ids := range r.handled {
+			handled += len(ids)
+		}
+		r.mu.Unlock()
+
+		if err := api.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if confirmed := n - s.PendingUpdates(); confirmed < handled {
+			t.Errorf("confirmed %d updates, want at least the %d handled", confirmed, handled)
+		}
+
+		<-done
+		checkOrder(t, r)
+	})
+}
@@ -4,15 +4,20 @@
 
 // Package tbotapi provides a Go wrapper for the Telegram Messenger Bot API.
 //
-// Note that, if the REST API returns an error, that error will be wrapped
-// in a Go error.
+// Note that, if the REST API returns an error, that error will be returned
+// as an *APIError, which can be matched against sentinel errors like
+// ErrBotBlocked using errors.Is. Failures to reach the API at all are
+// returned as a *TransportError.
 //
-// We currently only support long polling (i.e. no webhooks).
+// Updates are retrieved using long polling, or received through a webhook,
+// see SetWebhook and WebhookServer.
 // Feature-wise, everything up to and including the January 20 changes should
 // be implemented.
 //
 // Examples are provided in the examples package, so check that out.
 //
+// This package requires Go 1.21 or newer.
+//
 // The Bot API imposes certain limitations, these are especially interesting
 // for inline query results and files. This library does not keep track of
 // those limitations, so you'll have to perform checks yourself.
@@ -0,0 +1,96 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResponseParameters contains information about why a request was
+// unsuccessful.
+type ResponseParameters struct {
+	MigrateToChatID *int `json:"migrate_to_chat_id"` // The group has been migrated to a supergroup with this ID (optional).
+	RetryAfter      *int `json:"retry_after"`        // Seconds left to wait before the request can be repeated, in case of exceeded flood control (optional).
+}
+
+// An APIError is returned if the API rejected a request.
+// Use errors.Is to check for one of the sentinel errors like ErrBotBlocked
+// or errors.As to get to the error code and response parameters.
+type APIError struct {
+	ErrorCode   int                 // The error code returned by the API.
+	Description string              // Human-readable description of the error.
+	Parameters  *ResponseParameters // Additional information, if provided (optional).
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("tbotapi: API error: %d - %s", e.ErrorCode, e.Description)
+}
+
+// RetryAfter returns the time to wait before the request can be repeated,
+// or zero if the API did not provide one.
+func (e *APIError) RetryAfter() time.Duration {
+	if e.Parameters == nil || e.Parameters.RetryAfter == nil {
+		return 0
+	}
+	return time.Duration(*e.Parameters.RetryAfter) * time.Second
+}
+
+// Is reports whether the error matches one of the sentinel errors of this
+// package.
+func (e *APIError) Is(target error) bool {
+	matches, ok := apiErrorMatchers[target]
+	return ok && matches(e)
+}
+
+// Sentinel errors to be matched against an *APIError using errors.Is.
+var (
+	ErrBotBlocked         = errors.New("tbotapi: bot was blocked by the user")
+	ErrChatNotFound       = errors.New("tbotapi: chat not found")
+	ErrTooManyRequests    = errors.New("tbotapi: too many requests")
+	ErrMessageNotModified = errors.New("tbotapi: message is not modified")
+)
+
+var apiErrorMatchers = map[error]func(*APIError) bool{
+	ErrBotBlocked:         matchAPIError(403, "bot was blocked by the user"),
+	ErrChatNotFound:       matchAPIError(400, "chat not found"),
+	ErrTooManyRequests:    matchAPIError(429, ""),
+	ErrMessageNotModified: matchAPIError(400, "message is not modified"),
+}
+
+func matchAPIError(code int, description string) func(*APIError) bool {
+	return func(e *APIError) bool {
+		return e.ErrorCode == code && strings.Contains(strings.ToLower(e.Description), description)
+	}
+}
+
+// A TransportError is returned if a request failed before the API could
+// accept or reject it, for example because of network problems or a
+// server error.
+type TransportError struct {
+	Method     string // The API method that was called.
+	StatusCode int    // The HTTP status code, or 0 if no response was received.
+	Err        error  // The underlying error.
+
+	permanent bool // Whether the request could not be created.
+}
+
+// Error implements error. The message never contains the bot token.
+func (e *TransportError) Error() string {
+	return RedactURL(fmt.Sprintf("tbotapi: transport error calling %s: %s", e.Method, e.Err))
+}
+
+// Unwrap returns the underlying error.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// permanentError reports whether repeating the request does not help,
+// because it could not be created or was rejected with a 4xx status.
+func (e *TransportError) permanentError() bool {
+	return e.permanent || e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != 429
+}
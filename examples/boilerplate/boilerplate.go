@@ -38,25 +38,20 @@ func RunBot(apiKey string, bot BotFunc, name, description string) {
 	fmt.Printf("Bot Name: %s\n", api.Name)
 	fmt.Printf("Bot Username: %s\n", api.Username)
 
-	closed := make(chan struct{})
 	wg := &sync.WaitGroup{}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for {
-			select {
-			case <-closed:
-				return
-			case update := <-api.Updates:
-				if update.Error() != nil {
-					// TODO handle this properly
-					fmt.Printf("Update error: %s\n", update.Error())
-					continue
-				}
-
-				bot(update.Update(), api)
+		// The Updates channel is closed when the API is closed.
+		for update := range api.Updates {
+			if update.Error() != nil {
+				// TODO handle this properly
+				fmt.Printf("Update error: %s\n", update.Error())
+				continue
 			}
+
+			bot(update.Update(), api)
 		}
 	}()
 
@@ -76,18 +71,30 @@ func RunBot(apiKey string, bot BotFunc, name, description string) {
 	fmt.Println("Closing...")
 
 	// Always close the API first, let it clean up the update loop.
-	// This might take a while.
 	api.Close()
-	close(closed)
 	wg.Wait()
 }
 
 // RunBotOnWebhook runs the given BotFunc with a webhook.
+// If the pubkey and privkey files do not exist, a self-signed certificate
+// for webhookHost is generated and written to them.
 func RunBotOnWebhook(apiKey string, bot BotFunc, name, description, webhookHost string, webhookPort uint16, pubkey, privkey string) {
 	closing := make(chan struct{})
 
 	fmt.Printf("%s: %s\n", name, description)
 	fmt.Println("Starting...")
+
+	if _, err := os.Stat(pubkey); os.IsNotExist(err) {
+		fmt.Println("Generating certificate...")
+		cert, err := tbotapi.GenerateCertificate(webhookHost, tbotapi.CertificateConfig{})
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = cert.WriteFiles(pubkey, privkey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	u := url.URL{
 		Host:   webhookHost + ":" + fmt.Sprint(webhookPort),
 		Scheme: "https",
@@ -104,25 +111,20 @@ func RunBotOnWebhook(apiKey string, bot BotFunc, name, description, webhookHost
 	fmt.Printf("Bot Name: %s\n", api.Name)
 	fmt.Printf("Bot Username: %s\n", api.Username)
 
-	closed := make(chan struct{})
 	wg := &sync.WaitGroup{}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for {
-			select {
-			case <-closed:
-				return
-			case update := <-api.Updates:
-				if update.Error() != nil {
-					// TODO handle this properly
-					fmt.Printf("Update error: %s\n", update.Error())
-					continue
-				}
-
-				bot(update.Update(), api)
+		// The Updates channel is closed when the API is closed.
+		for update := range api.Updates {
+			if update.Error() != nil {
+				// TODO handle this properly
+				fmt.Printf("Update error: %s\n", update.Error())
+				continue
 			}
+
+			bot(update.Update(), api)
 		}
 	}()
 
@@ -150,6 +152,5 @@ func RunBotOnWebhook(apiKey string, bot BotFunc, name, description, webhookHost
 
 	// Always close the API first.
 	api.Close()
-	close(closed)
 	wg.Wait()
 }
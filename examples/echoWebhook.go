@@ -15,7 +15,7 @@ func main() {
 	apiToken := "123456789:Your_API_token_goes_here"
 	botHost := "your.host.com"
 	botPort := uint16(8443)
-	privkey := "private.key"
+	privkey := "private.key" // Generated together with pubkey, if missing.
 	pubkey := "public.pem"
 
 	updateFunc := func(update tbotapi.Update, api *tbotapi.TelegramBotAPI) {
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -39,8 +40,16 @@ func main() {
 				return
 			}
 			defer file.Close()
+			// Show that we are uploading while the upload is in flight.
+			stop := api.NewOutgoingChatAction(tbotapi.NewRecipientFromChat(msg.Chat), tbotapi.ChatActionUploadPhoto).KeepAlive(context.Background())
+			defer stop()
+
 			// Note: Set at least a correct file extension, the API will check this.
-			outMsg, err := api.NewOutgoingPhoto(tbotapi.NewRecipientFromChat(msg.Chat), "example.png", file).Send()
+			outMsg, err := api.NewOutgoingPhoto(tbotapi.NewRecipientFromChat(msg.Chat), "example.png", file).
+				SetProgressFunc(func(sent, total int64) {
+					fmt.Printf("Uploading: %d/%d bytes\n", sent, total)
+				}).
+				Send()
 
 			if err != nil {
 				fmt.Printf("Error sending: %s\n", err)
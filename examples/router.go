@@ -0,0 +1,71 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+)
+
+func main() {
+	apiToken := "123456789:Your_API_token_goes_here"
+
+	api, err := tbotapi.New(apiToken)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Bot started as @%s. Press CTRL-C to close...\n", api.Username)
+
+	// Replies are sent with the context of the handler, so they are
+	// canceled by the Timeout middleware below.
+	reply := func(ctx context.Context, msg *tbotapi.Message, text string) {
+		_, err := api.NewOutgoingMessage(tbotapi.NewRecipientFromChat(msg.Chat), text).SendContext(ctx)
+		if err != nil {
+			fmt.Printf("Error sending: %s\n", err)
+		}
+	}
+
+	router := tbotapi.NewRouter()
+
+	// Don't let a panicking handler take down the bot, and give up on
+	// updates that take too long.
+	router.Use(tbotapi.Recoverer(nil), tbotapi.Timeout(30*time.Second))
+
+	// Handlers are tried in order, the first matching one is called.
+	router.HandleCommand("/start", func(ctx context.Context, api *tbotapi.TelegramBotAPI, update tbotapi.Update) {
+		reply(ctx, update.Message, "Hello! Send me some text and I'll echo it back.")
+	})
+	router.HandleCommand("/help", func(ctx context.Context, api *tbotapi.TelegramBotAPI, update tbotapi.Update) {
+		reply(ctx, update.Message, "/start - say hello\n/help - show this help")
+	})
+	router.HandleMessageType(tbotapi.TextMessage, func(ctx context.Context, api *tbotapi.TelegramBotAPI, update tbotapi.Update) {
+		reply(ctx, update.Message, *update.Message.Text)
+	})
+	router.Fallback(func(ctx context.Context, api *tbotapi.TelegramBotAPI, update tbotapi.Update) {
+		fmt.Printf("Ignoring update of type %s\n", update.Type())
+	})
+	router.OnError(func(err error) {
+		fmt.Printf("Update error: %s\n", err)
+	})
+
+	// Close the API on CTRL-C, which stops the router.
+	go func() {
+		shutdown := make(chan os.Signal, 1)
+		signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+		<-shutdown
+		fmt.Println("Closing...")
+		api.Close()
+	}()
+
+	// Run the router, this will block until the API is closed.
+	router.Run(api)
+}
@@ -0,0 +1,281 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FloodLimits describes the limits enforced by the built-in flood
+// control.
+// A zero value for any of the rates disables that limit.
+type FloodLimits struct {
+	Global     int // Messages per second across all chats.
+	PerChat    int // Messages per second to a single private chat.
+	PerGroup   int // Messages per minute to a single group or channel.
+	MaxRetries int // How often a message is repeated after the API responded with 429 Too Many Requests.
+}
+
+// DefaultFloodLimits are the limits documented by Telegram.
+var DefaultFloodLimits = FloodLimits{
+	Global:     30,
+	PerChat:    1,
+	PerGroup:   20,
+	MaxRetries: 3,
+}
+
+// FloodControlStats contains statistics about the flood control.
+type FloodControlStats struct {
+	Queued    int           // Number of messages currently waiting to be sent.
+	Waited    uint64        // Number of messages that had to wait.
+	TotalWait time.Duration // Total time messages spent waiting.
+	MaxWait   time.Duration // Longest time a single message had to wait.
+	Retries   uint64        // Number of messages repeated after a 429 response.
+}
+
+// WithFloodControl enables flood control for all outgoing messages.
+// Messages are delayed so that the given limits are not exceeded, keyed on
+// their Recipient.
+// If the API still responds with 429 Too Many Requests, the message is
+// repeated after the time advised by the API, up to limits.MaxRetries
+// times. Uploads from an io.Reader cannot be repeated.
+func WithFloodControl(limits FloodLimits) Option {
+	return func(o *options) {
+		o.floodLimits = &limits
+	}
+}
+
+// FloodControlStats returns statistics about the flood control.
+// If flood control is not enabled, the zero value is returned.
+func (api *TelegramBotAPI) FloodControlStats() FloodControlStats {
+	if api.flood == nil {
+		return FloodControlStats{}
+	}
+
+	api.flood.mu.Lock()
+	defer api.flood.mu.Unlock()
+	return api.flood.stats
+}
+
+const floodPruneThreshold = 1024
+
+type floodControl struct {
+	limits         FloodLimits
+	globalInterval time.Duration
+	chatInterval   time.Duration
+	groupInterval  time.Duration
+
+	mu             sync.Mutex
+	global         []time.Time          // Reserved global slots, sorted.
+	next           map[string]time.Time // By recipient, the earliest next slot.
+	pruneThreshold int
+	stats          FloodControlStats
+}
+
+func newFloodControl(limits FloodLimits) *floodControl {
+	return &floodControl{
+		limits:         limits,
+		globalInterval: interval(limits.Global, time.Second),
+		chatInterval:   interval(limits.PerChat, time.Second),
+		groupInterval:  interval(limits.PerGroup, time.Minute),
+		next:           make(map[string]time.Time),
+		pruneThreshold: floodPruneThreshold,
+	}
+}
+
+func interval(rate int, per time.Duration) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return per / time.Duration(rate)
+}
+
+// floodKey returns the key to track the recipient under and whether the
+// recipient is a group or channel.
+// The key is empty for the zero Recipient, which is only subject to the
+// global limit; the API rejects messages to it anyway.
+func floodKey(r Recipient) (string, bool) {
+	if r.isChannel() {
+		return *r.ChannelID, true
+	}
+	if r.ChatID == nil {
+		return "", false
+	}
+	// Groups, supergroups and channels have negative IDs.
+	return fmt.Sprint(*r.ChatID), *r.ChatID < 0
+}
+
+// A floodReservation is a slot reserved to send a message.
+type floodReservation struct {
+	key      string
+	at       time.Time // The slot.
+	prevNext time.Time // f.next[key] before the reservation, if hadNext.
+	hadNext  bool
+	next     time.Time // f.next[key] after the reservation.
+}
+
+// reserve reserves a slot to send a message to the given recipient and
+// returns how long to wait until that slot.
+// The slot is the earliest one allowed for the recipient that is at least
+// the global interval apart from all other reserved slots, so messages to
+// other recipients can use the gaps left by a recipient that has to wait.
+func (f *floodControl) reserve(r Recipient) (floodReservation, time.Duration) {
+	key, group := floodKey(r)
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := floodReservation{key: key}
+	if key != "" {
+		res.prevNext, res.hadNext = f.next[key]
+	}
+
+	at := now
+	if res.hadNext && res.prevNext.After(at) {
+		at = res.prevNext
+	}
+	if f.globalInterval > 0 {
+		at = f.reserveGlobal(now, at)
+	}
+	res.at = at
+
+	if key != "" {
+		if group {
+			f.next[key] = at.Add(f.groupInterval)
+		} else {
+			f.next[key] = at.Add(f.chatInterval)
+		}
+		res.next = f.next[key]
+	}
+
+	if len(f.next) > f.pruneThreshold {
+		f.prune(now)
+	}
+
+	return res, at.Sub(now)
+}
+
+// reserveGlobal reserves the earliest global slot not before at.
+// Must be called with f.mu held.
+func (f *floodControl) reserveGlobal(now, at time.Time) time.Time {
+	// Slots more than an interval ago do not restrict anything anymore.
+	i := 0
+	for i < len(f.global) && !f.global[i].After(now.Add(-f.globalInterval)) {
+		i++
+	}
+	f.global = f.global[i:]
+
+	i = 0
+	for ; i < len(f.global); i++ {
+		slot := f.global[i]
+		if !slot.Add(f.globalInterval).After(at) {
+			continue
+		}
+		if !at.Add(f.globalInterval).After(slot) {
+			break
+		}
+		at = slot.Add(f.globalInterval)
+	}
+
+	f.global = append(f.global, time.Time{})
+	copy(f.global[i+1:], f.global[i:])
+	f.global[i] = at
+	return at
+}
+
+// release gives back a slot that was not used.
+// The slot for the recipient can only be given back as long as no later
+// slot was reserved for it, otherwise the later messages keep their slots
+// and the slot stays unused.
+func (f *floodControl) release(res floodReservation) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, slot := range f.global {
+		if slot.Equal(res.at) {
+			f.global = append(f.global[:i], f.global[i+1:]...)
+			break
+		}
+	}
+	if next, ok := f.next[res.key]; ok && next.Equal(res.next) {
+		if res.hadNext {
+			f.next[res.key] = res.prevNext
+		} else {
+			delete(f.next, res.key)
+		}
+	}
+}
+
+// prune removes all recipients that could be sent to right now.
+// Must be called with f.mu held.
+func (f *floodControl) prune(now time.Time) {
+	for key, next := range f.next {
+		if !next.After(now) {
+			delete(f.next, key)
+		}
+	}
+
+	f.pruneThreshold = 2 * len(f.next)
+	if f.pruneThreshold < floodPruneThreshold {
+		f.pruneThreshold = floodPruneThreshold
+	}
+}
+
+// backoff delays all further messages to the given recipient by d.
+func (f *floodControl) backoff(r Recipient, d time.Duration) {
+	key, _ := floodKey(r)
+	until := time.Now().Add(d)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if next, ok := f.next[key]; key != "" && (!ok || next.Before(until)) {
+		f.next[key] = until
+	}
+	f.stats.Retries++
+}
+
+// wait blocks until a message can be sent to the given recipient or the
+// context is done. If the context is done first, the slot is released.
+func (f *floodControl) wait(ctx context.Context, r Recipient) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	res, d := f.reserve(r)
+	if d <= 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	f.stats.Queued++
+	f.stats.Waited++
+	f.stats.TotalWait += d
+	if d > f.stats.MaxWait {
+		f.stats.MaxWait = d
+	}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.stats.Queued--
+		f.mu.Unlock()
+	}()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		f.release(res)
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slack is the time a test may take between reserving slots.
+const slack = 50 * time.Millisecond
+
+// assertDelay checks that d is want, minus the time that has passed since.
+func assertDelay(t *testing.T, name string, d, want time.Duration) {
+	t.Helper()
+	if d > want || d < want-slack {
+		t.Errorf("%s: delay = %v, want %v", name, d, want)
+	}
+}
+
+func TestFloodKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		r     Recipient
+		key   string
+		group bool
+	}{
+		{"private chat", NewChatRecipient(42), "42", false},
+		{"group", NewChatRecipient(-42), "-42", true},
+		{"channel", NewChannelRecipient("@channel"), "@channel", true},
+		{"zero recipient", Recipient{}, "", false},
+	}
+
+	for _, tt := range tests {
+		key, group := floodKey(tt.r)
+		if key != tt.key || group != tt.group {
+			t.Errorf("%s: floodKey = %q, %t, want %q, %t", tt.name, key, group, tt.key, tt.group)
+		}
+	}
+}
+
+func TestFloodControlPerChat(t *testing.T) {
+	f := newFloodControl(FloodLimits{PerChat: 2, PerGroup: 30})
+
+	steps := []struct {
+		name string
+		r    Recipient
+		want time.Duration
+	}{
+		{"first to chat", NewChatRecipient(1), 0},
+		{"second to chat", NewChatRecipient(1), 500 * time.Millisecond},
+		{"third to chat", NewChatRecipient(1), time.Second},
+		{"other chat", NewChatRecipient(2), 0},
+		{"first to group", NewChatRecipient(-1), 0},
+		{"second to group", NewChatRecipient(-1), 2 * time.Second},
+		{"first to channel", NewChannelRecipient("@channel"), 0},
+		{"second to channel", NewChannelRecipient("@channel"), 2 * time.Second},
+		{"zero recipient", Recipient{}, 0},
+		{"zero recipient again", Recipient{}, 0},
+	}
+
+	for _, step := range steps {
+		_, d := f.reserve(step.r)
+		assertDelay(t, step.name, d, step.want)
+	}
+}
+
+func TestFloodControlGlobal(t *testing.T) {
+	f := newFloodControl(FloodLimits{Global: 10, PerChat: 1})
+
+	steps := []struct {
+		name string
+		r    Recipient
+		want time.Duration
+	}{
+		{"first", NewChatRecipient(1), 0},
+		{"other chat", NewChatRecipient(2), 100 * time.Millisecond},
+		{"zero recipient", Recipient{}, 200 * time.Millisecond},
+		{"third chat", NewChatRecipient(3), 300 * time.Millisecond},
+		{"per chat limit is longer", NewChatRecipient(1), time.Second},
+		{"other chats fill the gap", NewChatRecipient(4), 400 * time.Millisecond},
+		{"after the per chat limit", NewChatRecipient(1), 2 * time.Second},
+		{"after the global slots", NewChatRecipient(5), 500 * time.Millisecond},
+	}
+
+	for _, step := range steps {
+		_, d := f.reserve(step.r)
+		assertDelay(t, step.name, d, step.want)
+	}
+}
+
+func TestFloodControlRelease(t *testing.T) {
+	f := newFloodControl(FloodLimits{Global: 10, PerChat: 1})
+	chat := NewChatRecipient(1)
+
+	f.reserve(chat)
+	res, _ := f.reserve(chat)
+	f.release(res)
+	_, d := f.reserve(chat)
+	assertDelay(t, "after releasing the last slot", d, time.Second)
+
+	// Global slots are given back, too.
+	f = newFloodControl(FloodLimits{Global: 1})
+	f.reserve(NewChatRecipient(1))
+	res, _ = f.reserve(NewChatRecipient(2))
+	f.reserve(NewChatRecipient(3))
+	f.release(res)
+	_, d = f.reserve(NewChatRecipient(4))
+	assertDelay(t, "released global slot", d, time.Second)
+
+	// Slots followed by later reservations to the same chat are not given
+	// back.
+	f = newFloodControl(FloodLimits{Global: 10, PerChat: 1})
+	f.reserve(chat)
+	res, _ = f.reserve(chat)
+	f.reserve(chat)
+	f.release(res)
+	_, d = f.reserve(chat)
+	assertDelay(t, "after releasing an earlier slot", d, 3*time.Second)
+
+	// The first slot to a chat is removed completely.
+	f = newFloodControl(FloodLimits{PerChat: 1})
+	res, _ = f.reserve(chat)
+	f.release(res)
+	if len(f.next) != 0 {
+		t.Errorf("%d chats tracked after releasing the only slot, want 0", len(f.next))
+	}
+}
+
+func TestFloodControlWaitCanceled(t *testing.T) {
+	f := newFloodControl(FloodLimits{PerChat: 1})
+	chat := NewChatRecipient(1)
+
+	if err := f.wait(context.Background(), chat); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := f.wait(ctx, chat)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The canceled message gave its slot back.
+	_, d := f.reserve(chat)
+	assertDelay(t, "after cancellation", d, time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := f.wait(ctx, NewChatRecipient(2)); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait with canceled context = %v, want context.Canceled", err)
+	}
+	if _, ok := f.next["2"]; ok {
+		t.Error("wait with canceled context reserved a slot")
+	}
+}
+
+func TestFloodControlBackoff(t *testing.T) {
+	f := newFloodControl(FloodLimits{Global: 10, PerChat: 1})
+
+	f.backoff(NewChatRecipient(1), 3*time.Second)
+	_, d := f.reserve(NewChatRecipient(1))
+	assertDelay(t, "after backoff", d, 3*time.Second)
+
+	// Backing off does not shorten the wait.
+	f.backoff(NewChatRecipient(1), time.Second)
+	_, d = f.reserve(NewChatRecipient(1))
+	assertDelay(t, "after shorter backoff", d, 4*time.Second)
+
+	// The zero recipient is not tracked.
+	f.backoff(Recipient{}, 2*time.Second)
+	_, d = f.reserve(Recipient{})
+	assertDelay(t, "after backoff of the zero recipient", d, 0)
+	if f.stats.Retries != 3 {
+		t.Errorf("%d retries, want 3", f.stats.Retries)
+	}
+}
+
+func TestFloodControlStats(t *testing.T) {
+	api := &TelegramBotAPI{}
+	if stats := api.FloodControlStats(); stats != (FloodControlStats{}) {
+		t.Errorf("stats without flood control = %+v, want the zero value", stats)
+	}
+
+	api.flood = newFloodControl(FloodLimits{PerChat: 20})
+	chat := NewChatRecipient(1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := api.flood.wait(context.Background(), chat); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+	api.flood.backoff(chat, 0)
+
+	stats := api.FloodControlStats()
+	if stats.Queued != 0 || stats.Waited != 2 || stats.Retries != 1 {
+		t.Errorf("stats = %+v, want 0 queued, 2 waited and 1 retry", stats)
+	}
+	if stats.TotalWait > elapsed || stats.TotalWait < 100*time.Millisecond-slack {
+		t.Errorf("total wait = %v, want about 100ms", stats.TotalWait)
+	}
+	if stats.MaxWait > 50*time.Millisecond || stats.MaxWait < 50*time.Millisecond-slack {
+		t.Errorf("max wait = %v, want about 50ms", stats.MaxWait)
+	}
+
+	// Waiting messages are counted as queued.
+	done := make(chan struct{})
+	go func() {
+		api.flood.wait(context.Background(), chat)
+		close(done)
+	}()
+	for api.FloodControlStats().Queued != 1 {
+		select {
+		case <-done:
+			t.Fatal("message was sent without waiting")
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+	<-done
+	if stats := api.FloodControlStats(); stats.Queued != 0 {
+		t.Errorf("%d messages queued after sending, want 0", stats.Queued)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// A HandlerMiddleware wraps a HandlerFunc, for example to recover from
+// panics or to restrict who may use a handler.
+type HandlerMiddleware func(next HandlerFunc) HandlerFunc
+
+// Chain wraps h in the given middleware.
+// The first middleware given is the outermost one, i.e. it sees an update
+// first.
+func Chain(h HandlerFunc, mw ...HandlerMiddleware) HandlerFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Use adds middleware that wraps every handler of the router, including
+// the fallback handler.
+// The first middleware given is the outermost one.
+func (r *Router) Use(mw ...HandlerMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Recoverer recovers from panics in handlers and logs them, together with
+// the update ID, the chat and the stack trace, at error level.
+// If l is nil, slog.Default() is used.
+func Recoverer(l *slog.Logger) HandlerMiddleware {
+	if l == nil {
+		l = slog.Default()
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *TelegramBotAPI, u Update) {
+			defer func() {
+				if p := recover(); p != nil {
+					attrs := append(updateAttrs(&u),
+						slog.String("panic", fmt.Sprint(p)),
+						slog.String("stack", string(debug.Stack())))
+					l.LogAttrs(ctx, slog.LevelError, "tbotapi: handler panicked", attrs...)
+				}
+			}()
+
+			next(ctx, api, u)
+		}
+	}
+}
+
+// Timeout cancels the context passed to the handler after d.
+// Handlers must pass the context on to their calls, e.g. to SendContext,
+// for the timeout to take effect.
+func Timeout(d time.Duration) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *TelegramBotAPI, u Update) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			next(ctx, api, u)
+		}
+	}
+}
+
+// UpdateLogger logs every handled update with its ID, type, chat, sender
+// and the time it took to handle, at debug level.
+// If l is nil, slog.Default() is used.
+func UpdateLogger(l *slog.Logger) HandlerMiddleware {
+	if l == nil {
+		l = slog.Default()
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *TelegramBotAPI, u Update) {
+			start := time.Now()
+			next(ctx, api, u)
+
+			attrs := append(updateAttrs(&u), slog.Duration("duration", time.Since(start)))
+			l.LogAttrs(ctx, slog.LevelDebug, "tbotapi: update handled", attrs...)
+		}
+	}
+}
+
+func updateAttrs(u *Update) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int("update_id", u.ID),
+		slog.String("type", u.Type().String()),
+	}
+	if c := u.Chat(); c != nil {
+		attrs = append(attrs, slog.Int("chat_id", c.ID))
+	}
+	if from := u.From(); from != nil {
+		attrs = append(attrs, slog.Int("user_id", from.ID))
+	}
+	return attrs
+}
+
+// Guard calls the handler only for updates allow returns true for.
+// Other updates are dropped.
+func Guard(allow func(ctx context.Context, api *TelegramBotAPI, u Update) bool) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *TelegramBotAPI, u Update) {
+			if allow(ctx, api, u) {
+				next(ctx, api, u)
+			}
+		}
+	}
+}
+
+// PrivateOnly restricts a handler to updates from private chats.
+func PrivateOnly() HandlerMiddleware {
+	return Guard(func(_ context.Context, _ *TelegramBotAPI, u Update) bool {
+		c := u.Chat()
+		return c != nil && c.IsPrivateChat()
+	})
+}
+
+// AdminsOnly restricts a handler to updates sent by administrators of the
+// group or supergroup they originate from.
+// Every update is checked with a call to GetChatMember. Updates from
+// private chats, channels, updates without a chat and updates for which the
+// check fails are dropped.
+func AdminsOnly() HandlerMiddleware {
+	return Guard(func(ctx context.Context, api *TelegramBotAPI, u Update) bool {
+		c, from := u.Chat(), u.From()
+		if c == nil || from == nil || !(c.IsGroupChat() || c.IsSupergroup()) {
+			return false
+		}
+
+		resp, err := api.GetChatMemberContext(ctx, NewRecipientFromChat(*c), from.ID)
+		return err == nil && resp.ChatMember.IsAdmin()
+	})
+}
+
+// AllowUsers restricts a handler to updates sent by the given users.
+func AllowUsers(userIDs ...int) HandlerMiddleware {
+	allowed := make(map[int]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		allowed[id] = struct{}{}
+	}
+
+	return Guard(func(_ context.Context, _ *TelegramBotAPI, u Update) bool {
+		from := u.From()
+		if from == nil {
+			return false
+		}
+		_, ok := allowed[from.ID]
+		return ok
+	})
+}
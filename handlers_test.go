@@ -0,0 +1,61 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+func TestAdminsOnly(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	api, err := s.NewBot(tbotapi.WithoutAutoStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	group := tbotapi.Chat{ID: -100, Type: tbotapi.GroupChatType}
+	admin := tbotapi.User{ID: 1, FirstName: "Admin"}
+	user := tbotapi.User{ID: 2, FirstName: "User"}
+	s.SetChatMember(group.ID, tbotapi.ChatMember{User: admin, Status: tbotapi.MemberStatusAdministrator})
+
+	var handled []int
+	h := tbotapi.Chain(func(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+		handled = append(handled, u.Message.From.ID)
+	}, tbotapi.AdminsOnly())
+
+	tests := []struct {
+		name string
+		chat tbotapi.Chat
+		from tbotapi.User
+		want bool
+	}{
+		{"admin in group", group, admin, true},
+		{"member in group", group, user, false},
+		{"admin in private chat", tbotapi.Chat{ID: admin.ID, Type: tbotapi.PrivateChatType}, admin, false},
+	}
+
+	for _, tt := range tests {
+		handled = nil
+		m := tbotapi.Message{}
+		m.Chat = tt.chat
+		m.From = tt.from
+		h(context.Background(), api, tbotapi.Update{Message: &m})
+
+		if got := len(handled) == 1; got != tt.want {
+			t.Errorf("%s: handled = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if n := len(s.CallsTo("getChatMember")); n != 2 {
+		t.Errorf("got %d calls to getChatMember, want 2", n)
+	}
+}
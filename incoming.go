@@ -6,12 +6,23 @@ package tbotapi
 
 import "fmt"
 import "sort"
+import "time"
 
 // BaseResponse contains the basic fields contained in every API response.
 type baseResponse struct {
-	Ok          bool   `json:"ok"`
-	Description string `json:"description"`
-	ErrorCode   int    `json:"error_code"`
+	Ok          bool                `json:"ok"`
+	Description string              `json:"description"`
+	ErrorCode   int                 `json:"error_code"`
+	Parameters  *ResponseParameters `json:"parameters"`
+}
+
+// apiResponse is implemented by all responses, which embed baseResponse.
+type apiResponse interface {
+	base() *baseResponse
+}
+
+func (br *baseResponse) base() *baseResponse {
+	return br
 }
 
 // Audio represents an audio file to be treated as music.
@@ -31,24 +42,32 @@ type Chat struct {
 	LastName  *string `json:"last_name"`  // Last name of the other party in a private chat.
 }
 
+// Chat types.
+const (
+	PrivateChatType = "private"
+	GroupChatType   = "group"
+	SupergroupType  = "supergroup"
+	ChannelType     = "channel"
+)
+
 // IsPrivateChat checks if the chat is a private chat.
 func (c Chat) IsPrivateChat() bool {
-	return c.Type == "private"
+	return c.Type == PrivateChatType
 }
 
 // IsGroupChat checks if the chat is a group chat.
 func (c Chat) IsGroupChat() bool {
-	return c.Type == "group"
+	return c.Type == GroupChatType
 }
 
 // IsSupergroup checks if the chat is a supergroup chat.
 func (c Chat) IsSupergroup() bool {
-	return c.Type == "supergroup"
+	return c.Type == SupergroupType
 }
 
 // IsChannel checks if the chat is a channel.
 func (c Chat) IsChannel() bool {
-	return c.Type == "channel"
+	return c.Type == ChannelType
 }
 
 func (c Chat) String() string {
@@ -80,6 +99,63 @@ func (c Chat) String() string {
 	return toReturn
 }
 
+// ChatMemberResponse represents the response sent by the API on a
+// GetChatMember request.
+type ChatMemberResponse struct {
+	baseResponse
+	ChatMember ChatMember `json:"result"`
+}
+
+// Chat member statuses.
+const (
+	MemberStatusCreator       = "creator"
+	MemberStatusAdministrator = "administrator"
+	MemberStatusMember        = "member"
+	MemberStatusLeft          = "left"
+	MemberStatusKicked        = "kicked"
+)
+
+// ChatMember contains information about a member of a chat.
+type ChatMember struct {
+	User   User   `json:"user"`   // Information about the user.
+	Status string `json:"status"` // The member's status in the chat, see the MemberStatus constants.
+}
+
+// IsAdmin checks if the member is the creator or an administrator of the
+// chat.
+func (m ChatMember) IsAdmin() bool {
+	return m.Status == MemberStatusCreator || m.Status == MemberStatusAdministrator
+}
+
+// WebhookInfoResponse represents the response sent by the API on a
+// GetWebhookInfo request.
+type WebhookInfoResponse struct {
+	baseResponse
+	WebhookInfo WebhookInfo `json:"result"`
+}
+
+// WebhookInfo contains information about the current status of a webhook.
+type WebhookInfo struct {
+	URL                          string   `json:"url"`                                       // Empty if no webhook is set.
+	HasCustomCertificate         bool     `json:"has_custom_certificate"`                    // Whether a self-signed certificate was uploaded.
+	PendingUpdateCount           int      `json:"pending_update_count"`                      // Number of updates awaiting delivery.
+	IPAddress                    string   `json:"ip_address,omitempty"`                      // The IP address updates are sent to.
+	LastErrorDate                int      `json:"last_error_date,omitempty"`                 // Timestamp of the last delivery error.
+	LastErrorMessage             string   `json:"last_error_message,omitempty"`              // Description of the last delivery error.
+	LastSynchronizationErrorDate int      `json:"last_synchronization_error_date,omitempty"` // Timestamp of the last error synchronizing with the Telegram datacenters.
+	MaxConnections               int      `json:"max_connections,omitempty"`                 // Maximum number of simultaneous connections.
+	AllowedUpdates               []string `json:"allowed_updates,omitempty"`                 // Names of the update types received, empty for all.
+}
+
+// LastError returns the time and description of the last error delivering
+// an update, or the zero time if there was none.
+func (wi WebhookInfo) LastError() (time.Time, string) {
+	if wi.LastErrorDate == 0 {
+		return time.Time{}, ""
+	}
+	return time.Unix(int64(wi.LastErrorDate), 0), wi.LastErrorMessage
+}
+
 // Contact represents a phone contact.
 type Contact struct {
 	PhoneNumber string `json:"phone_number"`
@@ -205,6 +281,7 @@ type noReplyMessage struct {
 	Text                  *string          `json:"text"`                    // The actual text content.
 	Entities              *[]MessageEntity `json:"entities"`                // For text messages, special entities like usernames, URLs, bot commands, etc. that appear in the text (optional).
 	Caption               *string          `json:"caption"`                 // Caption for photo or video messages.
+	CaptionEntities       *[]MessageEntity `json:"caption_entities"`        // For messages with a caption, special entities like bot commands that appear in the caption (optional).
 	Audio                 *Audio           `json:"audio"`                   // Information about audio contents.
 	Document              *Document        `json:"document"`                // Information about file contents.
 	Photo                 *[]PhotoSize     `json:"photo"`                   // Information about photo contents.
@@ -380,10 +457,37 @@ func (u *Update) Type() UpdateType {
 		return InlineQueryUpdate
 	} else if u.ChosenInlineResult != nil {
 		return ChosenInlineResultUpdate
+	} else if u.CallbackQuery != nil {
+		return CallbackQueryUpdate
 	}
 	return UnknownUpdate
 }
 
+// Chat returns the chat the update originated from, or nil if the update
+// is not bound to a chat, like inline queries.
+func (u *Update) Chat() *Chat {
+	if u.Message != nil {
+		return &u.Message.Chat
+	} else if u.CallbackQuery != nil && u.CallbackQuery.Message != nil {
+		return &u.CallbackQuery.Message.Chat
+	}
+	return nil
+}
+
+// From returns the user the update originated from, or nil if unknown.
+func (u *Update) From() *User {
+	if u.Message != nil {
+		return &u.Message.From
+	} else if u.InlineQuery != nil {
+		return &u.InlineQuery.From
+	} else if u.ChosenInlineResult != nil {
+		return &u.ChosenInlineResult.From
+	} else if u.CallbackQuery != nil {
+		return &u.CallbackQuery.From
+	}
+	return nil
+}
+
 // UpdateType represents an update type.
 type UpdateType int
 
@@ -392,6 +496,7 @@ const (
 	MessageUpdate            UpdateType = iota // Message update.
 	InlineQueryUpdate                          // Inline query.
 	ChosenInlineResultUpdate                   // Chosen inline result.
+	CallbackQueryUpdate                        // Callback query.
 
 	UnknownUpdate // Unkown, probably due to API changes.
 )
@@ -400,6 +505,7 @@ var updateTypes = map[UpdateType]string{
 	MessageUpdate:            "Message",
 	InlineQueryUpdate:        "InlineQuery",
 	ChosenInlineResultUpdate: "ChosenInlineResult",
+	CallbackQueryUpdate:      "CallbackQuery",
 
 	UnknownUpdate: "Unknown",
 }
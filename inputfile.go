@@ -0,0 +1,125 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+)
+
+type inputFileKind int
+
+const (
+	inputFileNone inputFileKind = iota
+	inputFileUpload
+	inputFileID
+	inputFileURL
+	inputFilePath
+)
+
+// An InputFile represents a file to be sent.
+// It can either be uploaded from a reader, re-sent by its file ID,
+// downloaded by Telegram from an HTTP URL or, when using a local Bot API
+// server, read from the servers file system.
+//
+// Create an InputFile by calling FromReader, FromFileID, FromURL or
+// FromPath.
+type InputFile struct {
+	kind     inputFileKind
+	fileName string
+	r        io.Reader
+	value    string // The file ID, URL or file URI.
+}
+
+// FromReader creates an InputFile that is uploaded from r.
+// Note that the Telegram servers may check the fileName for its extension.
+func FromReader(fileName string, r io.Reader) InputFile {
+	return InputFile{
+		kind:     inputFileUpload,
+		fileName: fileName,
+		r:        r,
+	}
+}
+
+// FromFileID creates an InputFile that re-sends a file already stored on
+// the Telegram servers.
+func FromFileID(fileID string) InputFile {
+	return InputFile{
+		kind:  inputFileID,
+		value: fileID,
+	}
+}
+
+// FromURL creates an InputFile that Telegram downloads from the given HTTP
+// URL.
+// For current limitations on what can be sent by URL, please check the API
+// documentation.
+func FromURL(url string) InputFile {
+	return InputFile{
+		kind:  inputFileURL,
+		value: url,
+	}
+}
+
+// FromPath creates an InputFile that is read from the file system of the
+// Bot API server.
+// This only works with a self-hosted Bot API server running in local mode,
+// see WithBaseURL.
+func FromPath(path string) InputFile {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	return InputFile{
+		kind:  inputFilePath,
+		value: "file://" + filepath.ToSlash(path),
+	}
+}
+
+func (f InputFile) valid() bool {
+	switch f.kind {
+	case inputFileUpload:
+		return f.fileName != "" && f.r != nil
+	case inputFileID, inputFileURL, inputFilePath:
+		return f.value != ""
+	}
+	return false
+}
+
+func (f InputFile) isUpload() bool {
+	return f.kind == inputFileUpload
+}
+
+// ErrNoFileSpecified is returned in case no valid InputFile was specified.
+var ErrNoFileSpecified = errors.New("tbotapi: Neither a fileID, URL, path nor a fileName/reader were specified")
+
+// ErrThumbnailNotUploaded is returned in case a thumbnail was not created
+// by FromReader. Thumbnails cannot be re-sent and must always be uploaded.
+var ErrThumbnailNotUploaded = errors.New("tbotapi: Thumbnails must be uploaded from a reader")
+
+// ErrCertificateNotUploaded is returned in case a webhook certificate was
+// not created by FromReader. Certificates must always be uploaded.
+var ErrCertificateNotUploaded = errors.New("tbotapi: Certificates must be uploaded from a reader")
+
+// thumbnailAttachName is the name of the multipart field thumbnails are
+// uploaded as.
+const thumbnailAttachName = "thumbnail_file"
+
+// addFile adds f to the fields of a request under the given field name.
+// Uploads are appended to files instead.
+func addFile(fields querystring, files []file, fieldName string, f InputFile, progress ProgressFunc) []file {
+	if !f.isUpload() {
+		fields[fieldName] = f.value
+		return files
+	}
+
+	return append(files, file{
+		fieldName: fieldName,
+		fileName:  f.fileName,
+		r:         f.r,
+		progress:  progress,
+	})
+}
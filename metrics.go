@@ -0,0 +1,77 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Status values passed to Metrics.ObserveRequest besides API error codes.
+const (
+	StatusOK    = "ok"    // The call succeeded.
+	StatusError = "error" // The call failed before the API answered it.
+)
+
+// Metrics receives measurements from a TelegramBotAPI.
+// Implementations must be safe for concurrent use.
+// See the metrics package for an implementation with expvar and Prometheus
+// output.
+type Metrics interface {
+	// ObserveRequest is called once for every attempt of a call to the
+	// Bot API.
+	// The status is StatusOK, StatusError or the API error code, for
+	// example "429".
+	ObserveRequest(method, status string, d time.Duration)
+
+	// AddUploadBytes is called with the number of file bytes uploaded
+	// for a call.
+	AddUploadBytes(method string, n int64)
+
+	// IncUpdates is called for every update received.
+	IncUpdates(t UpdateType)
+
+	// WatchPendingUpdates is called once for every client with a function
+	// returning the number of updates waiting in its Updates channel, to
+	// be sampled when the metrics are read.
+	// The returned function is called when the client shuts down, after
+	// which pending must no longer be sampled.
+	WatchPendingUpdates(pending func() int) (unwatch func())
+}
+
+// WithMetrics sets a Metrics to report to.
+// Requests are measured after all other middleware has run, so every
+// attempt of a repeated call is counted.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// metricsMiddleware reports every call to m.
+func metricsMiddleware(m Metrics) Middleware {
+	return func(next RoundTripper) RoundTripper {
+		return RoundTripperFunc(func(ctx context.Context, req *Request) error {
+			start := time.Now()
+			err := next.RoundTrip(ctx, req)
+			m.ObserveRequest(req.Method, requestStatus(err), time.Since(start))
+			return err
+		})
+	}
+}
+
+func requestStatus(err error) string {
+	if err == nil {
+		return StatusOK
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.ErrorCode)
+	}
+	return StatusError
+}
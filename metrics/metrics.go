@@ -0,0 +1,289 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+// Package metrics provides a tbotapi.Metrics that keeps counters and
+// histograms in memory and exposes them through expvar and in the Prometheus
+// text exposition format.
+//
+// Usage:
+//
+//	c := metrics.New()
+//	c.Publish("tbotapi")               // Exposes the metrics on /debug/vars.
+//	http.Handle("/metrics", c)         // Exposes the metrics to Prometheus.
+//	api, err := tbotapi.NewWithOptions(token, tbotapi.WithMetrics(c))
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets used by New.
+// They extend to two minutes to cover long polling.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// A Collector collects the metrics of one or more TelegramBotAPIs.
+// A Collector is an expvar.Var and an http.Handler serving the Prometheus
+// text format.
+type Collector struct {
+	buckets []float64
+
+	mu          sync.Mutex
+	requests    map[requestKey]uint64
+	latency     map[string]*histogram
+	uploadBytes map[string]uint64
+	updates     map[string]uint64
+	pending     map[int]func() int // By watch, see WatchPendingUpdates.
+	nextWatch   int
+}
+
+type requestKey struct {
+	method string
+	status string
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative.
+	sum    float64
+	count  uint64
+}
+
+var _ tbotapi.Metrics = &Collector{}
+
+// New creates a new Collector using DefaultBuckets.
+func New() *Collector {
+	return NewWithBuckets(DefaultBuckets)
+}
+
+// NewWithBuckets creates a new Collector with the given latency histogram
+// buckets, in seconds.
+func NewWithBuckets(buckets []float64) *Collector {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	return &Collector{
+		buckets:     b,
+		requests:    make(map[requestKey]uint64),
+		latency:     make(map[string]*histogram),
+		uploadBytes: make(map[string]uint64),
+		updates:     make(map[string]uint64),
+		pending:     make(map[int]func() int),
+	}
+}
+
+// ObserveRequest implements tbotapi.Metrics.
+func (c *Collector) ObserveRequest(method, status string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[requestKey{method, status}]++
+
+	h, ok := c.latency[method]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.latency[method] = h
+	}
+	s := d.Seconds()
+	i := sort.SearchFloat64s(c.buckets, s)
+	if i < len(c.buckets) {
+		h.counts[i]++
+	}
+	h.sum += s
+	h.count++
+}
+
+// AddUploadBytes implements tbotapi.Metrics.
+func (c *Collector) AddUploadBytes(method string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.uploadBytes[method] += uint64(n)
+}
+
+// IncUpdates implements tbotapi.Metrics.
+func (c *Collector) IncUpdates(t tbotapi.UpdateType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.updates[t.String()]++
+}
+
+// WatchPendingUpdates implements tbotapi.Metrics.
+// The pending updates of all watched clients are added up.
+func (c *Collector) WatchPendingUpdates(pending func() int) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.nextWatch
+	c.nextWatch++
+	c.pending[id] = pending
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		delete(c.pending, id)
+	}
+}
+
+// pendingUpdates samples the pending updates. c.mu must be held.
+func (c *Collector) pendingUpdates() int {
+	n := 0
+	for _, pending := range c.pending {
+		n += pending()
+	}
+	return n
+}
+
+// Publish publishes the Collector to expvar under the given name.
+// Like expvar.Publish, it panics if the name is already in use.
+func (c *Collector) Publish(name string) {
+	expvar.Publish(name, c)
+}
+
+type jsonHistogram struct {
+	Buckets map[string]uint64 `json:"buckets"` // Cumulative, by upper bound.
+	Sum     float64           `json:"sum"`
+	Count   uint64            `json:"count"`
+}
+
+type jsonMetrics struct {
+	Requests       map[string]map[string]uint64 `json:"requests"`
+	Latency        map[string]jsonHistogram     `json:"latency_seconds"`
+	UploadBytes    map[string]uint64            `json:"upload_bytes"`
+	Updates        map[string]uint64            `json:"updates"`
+	PendingUpdates int                          `json:"pending_updates"`
+}
+
+// String returns the metrics as JSON, which makes a Collector an
+// expvar.Var.
+func (c *Collector) String() string {
+	c.mu.Lock()
+	m := jsonMetrics{
+		Requests:       make(map[string]map[string]uint64),
+		Latency:        make(map[string]jsonHistogram),
+		UploadBytes:    make(map[string]uint64),
+		Updates:        make(map[string]uint64),
+		PendingUpdates: c.pendingUpdates(),
+	}
+	for k, v := range c.requests {
+		if m.Requests[k.method] == nil {
+			m.Requests[k.method] = make(map[string]uint64)
+		}
+		m.Requests[k.method][k.status] = v
+	}
+	for method, h := range c.latency {
+		jh := jsonHistogram{Buckets: make(map[string]uint64), Sum: h.sum, Count: h.count}
+		var cumulative uint64
+		for i, b := range c.buckets {
+			cumulative += h.counts[i]
+			jh.Buckets[formatFloat(b)] = cumulative
+		}
+		m.Latency[method] = jh
+	}
+	for k, v := range c.uploadBytes {
+		m.UploadBytes[k] = v
+	}
+	for k, v := range c.updates {
+		m.Updates[k] = v
+	}
+	c.mu.Unlock()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(c.prometheus())
+}
+
+func (c *Collector) prometheus() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+
+	header(buf, "tbotapi_requests_total", "counter", "Calls to the Bot API by method and status.")
+	keys := make([]requestKey, 0, len(c.requests))
+	for k := range c.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, k := range keys {
+		fmt.Fprintf(buf, "tbotapi_requests_total{method=%s,status=%s} %d\n", label(k.method), label(k.status), c.requests[k])
+	}
+
+	header(buf, "tbotapi_request_duration_seconds", "histogram", "Latency of calls to the Bot API by method.")
+	for _, method := range sortedKeys(c.latency) {
+		h := c.latency[method]
+		var cumulative uint64
+		for i, b := range c.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "tbotapi_request_duration_seconds_bucket{method=%s,le=%q} %d\n", label(method), formatFloat(b), cumulative)
+		}
+		fmt.Fprintf(buf, "tbotapi_request_duration_seconds_bucket{method=%s,le=\"+Inf\"} %d\n", label(method), h.count)
+		fmt.Fprintf(buf, "tbotapi_request_duration_seconds_sum{method=%s} %s\n", label(method), formatFloat(h.sum))
+		fmt.Fprintf(buf, "tbotapi_request_duration_seconds_count{method=%s} %d\n", label(method), h.count)
+	}
+
+	header(buf, "tbotapi_upload_bytes_total", "counter", "File bytes uploaded to the Bot API by method.")
+	for _, method := range sortedKeys(c.uploadBytes) {
+		fmt.Fprintf(buf, "tbotapi_upload_bytes_total{method=%s} %d\n", label(method), c.uploadBytes[method])
+	}
+
+	header(buf, "tbotapi_updates_total", "counter", "Updates received by type.")
+	for _, typ := range sortedKeys(c.updates) {
+		fmt.Fprintf(buf, "tbotapi_updates_total{type=%s} %d\n", label(typ), c.updates[typ])
+	}
+
+	header(buf, "tbotapi_pending_updates", "gauge", "Updates waiting to be consumed.")
+	fmt.Fprintf(buf, "tbotapi_pending_updates %d\n", c.pendingUpdates())
+
+	return buf.Bytes()
+}
+
+func header(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a label value for the Prometheus text format.
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
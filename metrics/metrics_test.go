@@ -0,0 +1,148 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+// collect returns a Collector with a few measurements.
+func collect() *Collector {
+	c := NewWithBuckets([]float64{1, .1})
+	c.ObserveRequest("sendMessage", tbotapi.StatusOK, 250*time.Millisecond)
+	c.ObserveRequest("sendMessage", "429", 2*time.Second)
+	c.ObserveRequest("getUpdates", tbotapi.StatusOK, 500*time.Millisecond)
+	c.AddUploadBytes("sendPhoto", 1024)
+	c.AddUploadBytes("sendPhoto", 512)
+	c.IncUpdates(tbotapi.MessageUpdate)
+	c.IncUpdates(tbotapi.MessageUpdate)
+	c.IncUpdates(tbotapi.CallbackQueryUpdate)
+	c.WatchPendingUpdates(func() int { return 3 })
+	unwatch := c.WatchPendingUpdates(func() int { return 100 })
+	unwatch()
+	c.WatchPendingUpdates(func() int { return 2 })
+	return c
+}
+
+func TestExpvar(t *testing.T) {
+	want := `{"requests":{"getUpdates":{"ok":1},"sendMessage":{"429":1,"ok":1}},` +
+		`"latency_seconds":{"getUpdates":{"buckets":{"0.1":0,"1":1},"sum":0.5,"count":1},` +
+		`"sendMessage":{"buckets":{"0.1":0,"1":1},"sum":2.25,"count":2}},` +
+		`"upload_bytes":{"sendPhoto":1536},` +
+		`"updates":{"CallbackQuery":1,"Message":2},` +
+		`"pending_updates":5}`
+
+	if got := collect().String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+
+	want = `{"requests":{},"latency_seconds":{},"upload_bytes":{},"updates":{},"pending_updates":0}`
+	if got := New().String(); got != want {
+		t.Errorf("empty String() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	want := `# HELP tbotapi_requests_total Calls to the Bot API by method and status.
+# TYPE tbotapi_requests_total counter
+tbotapi_requests_total{method="getUpdates",status="ok"} 1
+tbotapi_requests_total{method="sendMessage",status="429"} 1
+tbotapi_requests_total{method="sendMessage",status="ok"} 1
+# HELP tbotapi_request_duration_seconds Latency of calls to the Bot API by method.
+# TYPE tbotapi_request_duration_seconds histogram
+tbotapi_request_duration_seconds_bucket{method="getUpdates",le="0.1"} 0
+tbotapi_request_duration_seconds_bucket{method="getUpdates",le="1"} 1
+tbotapi_request_duration_seconds_bucket{method="getUpdates",le="+Inf"} 1
+tbotapi_request_duration_seconds_sum{method="getUpdates"} 0.5
+tbotapi_request_duration_seconds_count{method="getUpdates"} 1
+tbotapi_request_duration_seconds_bucket{method="sendMessage",le="0.1"} 0
+tbotapi_request_duration_seconds_bucket{method="sendMessage",le="1"} 1
+tbotapi_request_duration_seconds_bucket{method="sendMessage",le="+Inf"} 2
+tbotapi_request_duration_seconds_sum{method="sendMessage"} 2.25
+tbotapi_request_duration_seconds_count{method="sendMessage"} 2
+# HELP tbotapi_upload_bytes_total File bytes uploaded to the Bot API by method.
+# TYPE tbotapi_upload_bytes_total counter
+tbotapi_upload_bytes_total{method="sendPhoto"} 1536
+# HELP tbotapi_updates_total Updates received by type.
+# TYPE tbotapi_updates_total counter
+tbotapi_updates_total{type="CallbackQuery"} 1
+tbotapi_updates_total{type="Message"} 2
+# HELP tbotapi_pending_updates Updates waiting to be consumed.
+# TYPE tbotapi_pending_updates gauge
+tbotapi_pending_updates 5
+`
+
+	w := httptest.NewRecorder()
+	collect().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if got := w.Body.String(); got != want {
+		t.Errorf("Prometheus output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`sendMessage`, `"sendMessage"`},
+		{`a"b`, `"a\"b"`},
+		{`a\b`, `"a\\b"`},
+		{"a\nb", `"a\nb"`},
+	}
+
+	for _, test := range tests {
+		if got := label(test.in); got != test.want {
+			t.Errorf("label(%q) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+func TestWatchPendingUpdates(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	c := New()
+	watches := func() int {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.pending)
+	}
+
+	s.Fail("getMe", tbotapitest.Forbidden())
+	_, err := s.NewBot(tbotapi.WithMetrics(c), tbotapi.WithoutAutoStart())
+	if err == nil {
+		t.Fatal("expected getMe to fail")
+	}
+	if n := watches(); n != 0 {
+		t.Errorf("%d watches after getMe failed, want 0", n)
+	}
+
+	api, err := s.NewBot(tbotapi.WithMetrics(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := watches(); n != 1 {
+		t.Errorf("%d watches for a running client, want 1", n)
+	}
+
+	api.Close()
+	if n := watches(); n != 0 {
+		t.Errorf("%d watches after Close, want 0", n)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := c.requests[requestKey{"getMe", "403"}]; n != 1 {
+		t.Errorf("%d failed calls to getMe recorded, want 1", n)
+	}
+}
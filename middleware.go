@@ -0,0 +1,144 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// A Request represents a single call to the Bot API as seen by
+// middleware.
+// Middleware may change Params and Header before passing the request on.
+type Request struct {
+	Method string        // The API method, e.g. "sendMessage".
+	Params interface{}   // The parameters, either a map[string]string or a value encoded as JSON.
+	Header http.Header   // Additional HTTP headers sent with the request.
+	Files  []RequestFile // Files uploaded with the request, if any.
+	Result interface{}   // The value the response is decoded into. Only valid after the call returned.
+
+	send func(ctx context.Context, req *Request) error // Performs the HTTP request.
+}
+
+// fields returns the parameters of a request that is sent as a query
+// string, form or multipart form.
+func (r *Request) fields() (querystring, error) {
+	fields, ok := r.Params.(map[string]string)
+	if !ok && r.Params != nil {
+		return nil, fmt.Errorf("tbotapi: params of %s must be a map[string]string, not %T", r.Method, r.Params)
+	}
+	return fields, nil
+}
+
+// setHeader adds the additional headers to req.
+func (r *Request) setHeader(req *http.Request) {
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+}
+
+// RequestFile describes a file uploaded with a Request.
+type RequestFile struct {
+	FieldName string // Name of the multipart field.
+	FileName  string // Name of the file.
+}
+
+// A RoundTripper performs a Request.
+type RoundTripper interface {
+	RoundTrip(ctx context.Context, req *Request) error
+}
+
+// RoundTripperFunc is an adapter to use a function as a RoundTripper.
+type RoundTripperFunc func(ctx context.Context, req *Request) error
+
+// RoundTrip implements RoundTripper.
+func (f RoundTripperFunc) RoundTrip(ctx context.Context, req *Request) error {
+	return f(ctx, req)
+}
+
+// A Middleware wraps a RoundTripper to observe or modify every call to the
+// Bot API.
+type Middleware func(next RoundTripper) RoundTripper
+
+// WithMiddleware adds middleware to the client.
+// The first middleware given is the outermost one, i.e. it sees a call
+// first and its result last.
+// Every attempt of a repeated call passes through the middleware.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+// transport is the innermost RoundTripper, which performs the HTTP request
+// and checks the API response for errors.
+var transport = RoundTripperFunc(func(ctx context.Context, req *Request) error {
+	err := req.send(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if r, ok := req.Result.(apiResponse); ok {
+		return check(r.base())
+	}
+	return nil
+})
+
+func chain(rt RoundTripper, mw []Middleware) RoundTripper {
+	for i := len(mw) - 1; i >= 0; i-- {
+		rt = mw[i](rt)
+	}
+	return rt
+}
+
+// LoggingMiddleware logs every call to the Bot API with its method,
+// duration and, if it failed, the error.
+// Successful calls are logged at debug level, failed ones at warn level.
+func LoggingMiddleware(l *slog.Logger) Middleware {
+	return func(next RoundTripper) RoundTripper {
+		return RoundTripperFunc(func(ctx context.Context, req *Request) error {
+			start := time.Now()
+			err := next.RoundTrip(ctx, req)
+
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if len(req.Files) > 0 {
+				attrs = append(attrs, slog.Int("files", len(req.Files)))
+			}
+
+			if err == nil {
+				l.LogAttrs(ctx, slog.LevelDebug, "tbotapi: call succeeded", attrs...)
+				return nil
+			}
+
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				attrs = append(attrs, slog.Int("error_code", apiErr.ErrorCode))
+			}
+			attrs = append(attrs, slog.String("error", RedactURL(err.Error())))
+			l.LogAttrs(ctx, slog.LevelWarn, "tbotapi: call failed", attrs...)
+			return err
+		})
+	}
+}
+
+// LatencyMiddleware calls observe with the method, duration and error of
+// every call to the Bot API.
+func LatencyMiddleware(observe func(method string, d time.Duration, err error)) Middleware {
+	return func(next RoundTripper) RoundTripper {
+		return RoundTripperFunc(func(ctx context.Context, req *Request) error {
+			start := time.Now()
+			err := next.RoundTrip(ctx, req)
+			observe(req.Method, time.Since(start), err)
+			return err
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An OffsetStore persists the offset of the next update to be retrieved,
+// so that a bot continues where it left off after a restart.
+//
+// If an OffsetStore is set, updates must be acknowledged with BotUpdate.Ack
+// once they are handled. The offset is committed only for acknowledged
+// updates, and the next updates are retrieved only after all updates
+// retrieved before were acknowledged. This gives at-least-once processing:
+// after a crash, updates that were not acknowledged are received again.
+//
+// An update that is never acknowledged stalls the polling loop. If no
+// update of a batch is acknowledged for the ack timeout, an
+// *UnacknowledgedError is delivered on the Updates channel, see
+// WithAckTimeout.
+type OffsetStore interface {
+	// Load returns the committed offset, or 0 if there is none.
+	Load() (int, error)
+
+	// Commit stores the offset, which is the ID of the last handled
+	// update plus one.
+	Commit(offset int) error
+}
+
+// WithOffsetStore sets an OffsetStore, see OffsetStore for details.
+func WithOffsetStore(s OffsetStore) Option {
+	return func(o *options) {
+		o.offsetStore = s
+	}
+}
+
+// DefaultAckTimeout is the default ack timeout, see WithAckTimeout.
+const DefaultAckTimeout = time.Minute
+
+// WithAckTimeout sets how long the polling loop waits for acknowledgements
+// before it delivers an *UnacknowledgedError on the Updates channel.
+// The error is repeated as long as no progress is made. It only applies
+// if an OffsetStore is set.
+// Zero or less disables the warning.
+// The default is DefaultAckTimeout.
+func WithAckTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.ackTimeout = d
+	}
+}
+
+// An UnacknowledgedError is delivered on the Updates channel if updates
+// were not acknowledged in time while an OffsetStore is set.
+// Updates are not retrieved until they are acknowledged, so this usually
+// means that BotUpdate.Ack is not called for some updates.
+type UnacknowledgedError struct {
+	UpdateIDs []int         // The IDs of the updates not acknowledged yet.
+	Waited    time.Duration // How long no update was acknowledged.
+}
+
+func (e *UnacknowledgedError) Error() string {
+	return fmt.Sprintf("tbotapi: %d updates not acknowledged after %s, starting with update %d",
+		len(e.UpdateIDs), e.Waited, e.UpdateIDs[0])
+}
+
+// MemoryOffsetStore is an OffsetStore keeping the offset in memory, for
+// example to share it between successive clients in one process.
+type MemoryOffsetStore struct {
+	mu     sync.Mutex
+	offset int
+}
+
+// NewMemoryOffsetStore creates a new, empty MemoryOffsetStore.
+func NewMemoryOffsetStore() *MemoryOffsetStore {
+	return &MemoryOffsetStore{}
+}
+
+// Load implements OffsetStore.
+func (s *MemoryOffsetStore) Load() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.offset, nil
+}
+
+// Commit implements OffsetStore.
+func (s *MemoryOffsetStore) Commit(offset int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offset = offset
+	return nil
+}
+
+// FileOffsetStore is an OffsetStore keeping the offset in a file.
+// The file is replaced atomically on every commit.
+type FileOffsetStore struct {
+	path string
+}
+
+// NewFileOffsetStore creates a new FileOffsetStore using the file at path.
+// The file does not need to exist.
+func NewFileOffsetStore(path string) *FileOffsetStore {
+	return &FileOffsetStore{path: path}
+}
+
+// Load implements OffsetStore.
+func (s *FileOffsetStore) Load() (int, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// Commit implements OffsetStore.
+func (s *FileOffsetStore) Commit(offset int) error {
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(strconv.Itoa(offset) + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// batchAcks tracks the acknowledgements of one batch of updates.
+type batchAcks struct {
+	acked chan int // Indices of acknowledged updates.
+}
+
+func newBatchAcks(n int) *batchAcks {
+	return &batchAcks{acked: make(chan int, n)}
+}
+
+// ackFunc returns the function to acknowledge the i-th update.
+// Repeated calls are ignored.
+func (b *batchAcks) ackFunc(i int) func() {
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			b.acked <- i
+		})
+	}
+}
+
+// awaitAcks waits until all updates of the batch are acknowledged and
+// commits the offset after every acknowledged prefix of the batch.
+// If nothing is acknowledged for the ack timeout, it delivers an
+// *UnacknowledgedError and keeps waiting.
+// It returns the offset for the next batch and false if the client was
+// closed in the meantime.
+func (api *TelegramBotAPI) awaitAcks(updates []Update, acks *batchAcks, offset int) (int, bool) {
+	acked := make([]bool, len(updates))
+	done := 0
+
+	var (
+		timer   *time.Timer
+		timeout <-chan time.Time
+		since   = time.Now() // Of the last acknowledgement.
+	)
+	if api.ackTimeout > 0 {
+		timer = time.NewTimer(api.ackTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for done < len(updates) {
+		select {
+		case <-api.closed:
+			return offset, false
+		case i := <-acks.acked:
+			acked[i] = true
+			since = time.Now()
+			if timer != nil && !timer.Stop() {
+				<-timer.C
+			}
+		case <-timeout:
+			var pending []int
+			for i, update := range updates {
+				if !acked[i] {
+					pending = append(pending, update.ID)
+				}
+			}
+			if !api.deliver(BotUpdate{err: &UnacknowledgedError{UpdateIDs: pending, Waited: time.Since(since).Round(time.Millisecond)}}) {
+				return offset, false
+			}
+		}
+		if timer != nil {
+			timer.Reset(api.ackTimeout)
+		}
+
+		prefix := done
+		for prefix < len(updates) && acked[prefix] {
+			prefix++
+		}
+		if prefix == done {
+			continue
+		}
+		done = prefix
+
+		offset = updates[done-1].ID + 1
+		if err := api.offsetStore.Commit(offset); err != nil {
+			api.deliver(BotUpdate{err: err})
+		}
+	}
+
+	return offset, true
+}
@@ -0,0 +1,173 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+// receive returns the next n updates, failing on errors.
+func receive(t *testing.T, api *tbotapi.TelegramBotAPI, n int) []tbotapi.BotUpdate {
+	t.Helper()
+
+	var updates []tbotapi.BotUpdate
+	for len(updates) < n {
+		select {
+		case u := <-api.Updates:
+			if err := u.Error(); err != nil {
+				t.Fatal(err)
+			}
+			updates = append(updates, u)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d updates, want %d", len(updates), n)
+		}
+	}
+	return updates
+}
+
+// waitForOffset waits until the committed offset is want.
+func waitForOffset(t *testing.T, store tbotapi.OffsetStore, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("committed offset %d, want %d", got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOffsetStoreCommitsAcknowledgedPrefix(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	user := tbotapi.User{ID: 1, FirstName: "User"}
+	chat := tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}
+	var ids []int
+	for i := 0; i < 3; i++ {
+		ids = append(ids, s.AddText(chat, user, "hello"))
+	}
+
+	store := tbotapi.NewMemoryOffsetStore()
+	api, err := s.NewBot(tbotapi.WithOffsetStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	updates := receive(t, api, 3)
+	s.AddText(chat, user, "next batch")
+
+	// Acknowledging the last update commits nothing, as the ones before
+	// are not handled yet.
+	updates[2].Ack()
+	time.Sleep(20 * time.Millisecond)
+	waitForOffset(t, store, 0)
+
+	updates[0].Ack()
+	waitForOffset(t, store, ids[0]+1)
+
+	if n := len(s.CallsTo("getUpdates")); n != 1 {
+		t.Errorf("polled %d times before the batch was acknowledged, want once", n)
+	}
+
+	updates[1].Ack()
+	waitForOffset(t, store, ids[2]+1)
+
+	next := receive(t, api, 1)
+	if text := next[0].Update().Message.Text; text == nil || *text != "next batch" {
+		t.Errorf("got %v after the batch, want the next batch", next[0].Update())
+	}
+}
+
+func TestFileOffsetStoreRestart(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	user := tbotapi.User{ID: 1, FirstName: "User"}
+	chat := tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}
+	var ids []int
+	for i := 0; i < 3; i++ {
+		ids = append(ids, s.AddText(chat, user, "hello"))
+	}
+
+	path := filepath.Join(t.TempDir(), "offset")
+	api, err := s.NewBot(tbotapi.WithOffsetStore(tbotapi.NewFileOffsetStore(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := receive(t, api, 3)
+	updates[0].Ack()
+	updates[2].Ack()
+	waitForOffset(t, tbotapi.NewFileOffsetStore(path), ids[0]+1)
+	api.Close()
+
+	// After a restart, everything after the acknowledged prefix is
+	// received again.
+	api, err = s.NewBot(tbotapi.WithOffsetStore(tbotapi.NewFileOffsetStore(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	var got []int
+	for _, u := range receive(t, api, 2) {
+		got = append(got, u.Update().ID)
+		u.Ack()
+	}
+	if want := ids[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("received %v after restart, want %v", got, want)
+	}
+	waitForOffset(t, tbotapi.NewFileOffsetStore(path), ids[2]+1)
+}
+
+func TestUnacknowledgedError(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	user := tbotapi.User{ID: 1, FirstName: "User"}
+	chat := tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}
+	first := s.AddText(chat, user, "never acknowledged")
+	s.AddText(chat, user, "acknowledged")
+
+	api, err := s.NewBot(tbotapi.WithOffsetStore(tbotapi.NewMemoryOffsetStore()),
+		tbotapi.WithAckTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	updates := receive(t, api, 2)
+	updates[1].Ack()
+
+	select {
+	case u := <-api.Updates:
+		var unacked *tbotapi.UnacknowledgedError
+		if !errors.As(u.Error(), &unacked) {
+			t.Fatalf("got %v, want an *UnacknowledgedError", u.Error())
+		}
+		if want := []int{first}; !reflect.DeepEqual(unacked.UpdateIDs, want) {
+			t.Errorf("got unacknowledged updates %v, want %v", unacked.UpdateIDs, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error for an unacknowledged update")
+	}
+}
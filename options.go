@@ -0,0 +1,109 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the base URL of the official Bot API server.
+const DefaultBaseURL = "https://api.telegram.org"
+
+// An Option configures a TelegramBotAPI created by NewWithOptions.
+type Option func(*options)
+
+type options struct {
+	baseURL       string
+	httpClient    *http.Client
+	poll          PollConfig
+	updatesBuffer int
+	noAutoStart   bool
+	floodLimits   *FloodLimits
+	retryPolicy   RetryPolicy
+	retryHook     RetryHook
+	middleware    []Middleware
+	metrics       Metrics
+	offsetStore   OffsetStore
+	ackTimeout    time.Duration
+}
+
+func defaultOptions() *options {
+	return &options{
+		baseURL:     DefaultBaseURL,
+		poll:        PollConfig{Timeout: 60 * time.Second},
+		retryPolicy: DefaultRetryPolicy,
+		ackTimeout:  DefaultAckTimeout,
+	}
+}
+
+// WithBaseURL sets the base URL of the Bot API server, for example to use
+// a self-hosted Bot API server or a local stand-in for tests.
+// The URL must not contain the /bot<token> part, it will be appended
+// automatically.
+// The default is DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(o *options) {
+		o.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests.
+// Use this to inject a custom transport, proxy settings or timeouts.
+// Note that the client's timeout, if set, must be longer than the poll
+// timeout.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithPollTimeout sets the timeout used for long polling.
+// The default is 60 seconds.
+func WithPollTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.poll.Timeout = d
+	}
+}
+
+// WithPollLimit sets the maximum number of updates to be retrieved by one
+// long poll request.
+// The default (0) leaves it up to the API, which currently means 100.
+func WithPollLimit(limit int) Option {
+	return func(o *options) {
+		o.poll.Limit = limit
+	}
+}
+
+// WithAllowedUpdates sets the types of updates to be retrieved by long
+// polling. By default, all types are retrieved.
+func WithAllowedUpdates(types ...UpdateType) Option {
+	return func(o *options) {
+		o.poll.AllowedUpdates = types
+	}
+}
+
+// WithUpdatesBuffer sets the buffer size of the Updates channel.
+// Buffered updates are only confirmed to the API once they were received
+// from the channel, so the next updates are retrieved only after the
+// buffer ran empty. Consumers must read the updates they receive with
+// BotUpdate.Update or BotUpdate.Error, which wakes up the polling loop.
+// The default is an unbuffered channel.
+func WithUpdatesBuffer(size int) Option {
+	return func(o *options) {
+		o.updatesBuffer = size
+	}
+}
+
+// WithoutAutoStart prevents NewWithOptions from removing a webhook that
+// may be set and from starting the long polling loop.
+// The resulting client only calls GetMe during construction and will not
+// deliver anything on the Updates channel.
+func WithoutAutoStart() Option {
+	return func(o *options) {
+		o.noAutoStart = true
+	}
+}
@@ -17,4 +17,61 @@ type file struct {
 	fieldName string
 	fileName  string
 	r         io.Reader
+	progress  ProgressFunc
+}
+
+// A ProgressFunc is called while a file is uploaded with the number of
+// bytes sent so far and the total size of the file, or -1 if the size is
+// not known.
+type ProgressFunc func(sent, total int64)
+
+// progressReader reports progress while reading from r.
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func newProgressReader(r io.Reader, progress ProgressFunc) *progressReader {
+	return &progressReader{
+		r:        r,
+		total:    readerSize(r),
+		progress: progress,
+	}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.sent += int64(n)
+		pr.progress(pr.sent, pr.total)
+	}
+	return n, err
+}
+
+// readerSize determines the number of bytes left to read from r, or -1 if
+// that is not possible.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface {
+		Len() int
+	}:
+		return int64(r.Len())
+	case io.Seeker:
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		_, err = r.Seek(cur, io.SeekStart)
+		if err != nil {
+			return -1
+		}
+		return end - cur
+	}
+	return -1
 }
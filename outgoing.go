@@ -7,24 +7,75 @@ package tbotapi
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 )
 
-type outgoingSetWebhook struct {
-	URL string `json:"url"`
-	outgoingFileBase
+// WebhookParams are the parameters for SetWebhook.
+type WebhookParams struct {
+	// URL is the HTTPS URL updates are sent to.
+	URL string
+
+	// Certificate is the public key certificate to be checked by the API,
+	// for self-signed certificates. It must be created by FromReader.
+	// May be nil.
+	Certificate *InputFile
+
+	// IPAddress is the fixed IP address updates are sent to instead of the
+	// address resolved through DNS. May be empty.
+	IPAddress string
+
+	// MaxConnections is the maximum number of simultaneous connections
+	// for update delivery, 1-100. Zero uses the default of 40.
+	MaxConnections int
+
+	// AllowedUpdates are the types of updates to be received, see
+	// PollConfig.AllowedUpdates. Nil keeps the previous setting.
+	AllowedUpdates []UpdateType
+
+	// DropPendingUpdates drops all pending updates.
+	DropPendingUpdates bool
+
+	// SecretToken is sent in the X-Telegram-Bot-Api-Secret-Token header of
+	// every webhook request, 1-256 characters A-Z, a-z, 0-9, _ and -.
+	// May be empty.
+	SecretToken string
 }
 
-// querystring implements querystringer to represent the outgoing certificate
-// file.
-func (ow *outgoingSetWebhook) querystring() querystring {
-	toReturn := make(map[string]string)
+// fields returns the form fields and files for a setWebhook request.
+func (wp *WebhookParams) fields() (querystring, []file, error) {
+	toReturn := querystring{"url": wp.URL}
+	var files []file
 
-	if ow.URL != "" {
-		toReturn["url"] = ow.URL
+	if wp.Certificate != nil {
+		if !wp.Certificate.isUpload() || !wp.Certificate.valid() {
+			return nil, nil, ErrCertificateNotUploaded
+		}
+		files = addFile(toReturn, files, "certificate", *wp.Certificate, nil)
+	}
+	if wp.IPAddress != "" {
+		toReturn["ip_address"] = wp.IPAddress
+	}
+	if wp.MaxConnections != 0 {
+		toReturn["max_connections"] = fmt.Sprint(wp.MaxConnections)
+	}
+	if wp.AllowedUpdates != nil {
+		allowed, err := allowedUpdatesJSON(wp.AllowedUpdates)
+		if err != nil {
+			return nil, nil, err
+		}
+		toReturn["allowed_updates"] = allowed
+	}
+	if wp.DropPendingUpdates {
+		toReturn["drop_pending_updates"] = "true"
+	}
+	if wp.SecretToken != "" {
+		toReturn["secret_token"] = wp.SecretToken
 	}
 
-	return querystring(toReturn)
+	return toReturn, files, nil
+}
+
+type outgoingDeleteWebhook struct {
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
 }
 
 // outgoingBase contains fields shared by most of the outgoing requests.
@@ -33,6 +84,10 @@ type outgoingBase struct {
 	Recipient Recipient `json:"chat_id"`
 }
 
+func (op *outgoingBase) recipient() Recipient {
+	return op.Recipient
+}
+
 // outgoingMessageBase contains fields shared by most of the outgoing
 // messages.
 type outgoingMessageBase struct {
@@ -130,7 +185,7 @@ func (op *outgoingMessageBase) getBaseQueryString() querystring {
 		toReturn["reply_to_message_id"] = fmt.Sprint(op.ReplyToMessageID)
 	}
 
-	if op.replyMarkupSet {
+	if op.ReplyMarkup != nil {
 		b, err := json.Marshal(op.ReplyMarkup)
 		if err != nil {
 			panic(err)
@@ -146,32 +201,78 @@ func (op *outgoingMessageBase) getBaseQueryString() querystring {
 }
 
 type outgoingFileBase struct {
-	fileName string
-	r        io.Reader
-	fileID   string
+	file     InputFile
+	progress ProgressFunc
 }
 
 func (b outgoingFileBase) valid() bool {
-	return b.isUpload() || b.isResend()
+	return b.file.valid()
 }
 
 func (b outgoingFileBase) isUpload() bool {
-	return b.fileName != "" && b.r != nil && b.fileID == ""
+	return b.file.isUpload()
+}
+
+// files adds the file to fields or, if it is uploaded, returns it as a
+// file to be uploaded under fieldName.
+func (b outgoingFileBase) files(fields querystring, fieldName string) []file {
+	return addFile(fields, nil, fieldName, b.file, b.progress)
+}
+
+// outgoingThumbnailBase contains the thumbnail shared by some of the
+// outgoing files.
+type outgoingThumbnailBase struct {
+	thumbnail *InputFile
+}
+
+func (b outgoingThumbnailBase) isUpload() bool {
+	return b.thumbnail != nil
 }
 
-func (b outgoingFileBase) isResend() bool {
-	return b.fileName == "" && b.r == nil && b.fileID != ""
+// thumbnailFiles attaches the thumbnail, if set, to fields and files.
+func (b outgoingThumbnailBase) thumbnailFiles(fields querystring, files []file) ([]file, error) {
+	if b.thumbnail == nil {
+		return files, nil
+	}
+	if !b.thumbnail.isUpload() || !b.thumbnail.valid() {
+		return nil, ErrThumbnailNotUploaded
+	}
+
+	fields["thumb"] = "attach://" + thumbnailAttachName
+	return addFile(fields, files, thumbnailAttachName, *b.thumbnail, nil), nil
 }
 
 // OutgoingAudio represents an outgoing audio file.
 type OutgoingAudio struct {
 	outgoingMessageBase
 	outgoingFileBase
+	outgoingThumbnailBase
 	Duration  int    `json:"duration,omitempty"`
 	Title     string `json:"title,omitempty"`
 	Performer string `json:"performer,omitempty"`
 }
 
+// SetProgressFunc sets a function to be called with the progress of the
+// upload of the audio file (optional).
+// It is only called if the file is uploaded from a reader.
+func (oa *OutgoingAudio) SetProgressFunc(to ProgressFunc) *OutgoingAudio {
+	oa.progress = to
+	return oa
+}
+
+// SetThumbnail sets a thumbnail for the audio file (optional).
+// Thumbnails must be uploaded using FromReader, see the API documentation
+// for limitations.
+func (oa *OutgoingAudio) SetThumbnail(to InputFile) *OutgoingAudio {
+	oa.thumbnail = &to
+	return oa
+}
+
+// isUpload checks whether the audio file or its thumbnail are uploaded.
+func (oa *OutgoingAudio) isUpload() bool {
+	return oa.outgoingFileBase.isUpload() || oa.outgoingThumbnailBase.isUpload()
+}
+
 // SetDuration sets a duration for the audio file (optional).
 func (oa *OutgoingAudio) SetDuration(to int) *OutgoingAudio {
 	oa.Duration = to
@@ -213,6 +314,28 @@ func (oa *OutgoingAudio) querystring() querystring {
 type OutgoingDocument struct {
 	outgoingMessageBase
 	outgoingFileBase
+	outgoingThumbnailBase
+}
+
+// SetProgressFunc sets a function to be called with the progress of the
+// upload of the document (optional).
+// It is only called if the file is uploaded from a reader.
+func (od *OutgoingDocument) SetProgressFunc(to ProgressFunc) *OutgoingDocument {
+	od.progress = to
+	return od
+}
+
+// SetThumbnail sets a thumbnail for the file (optional).
+// Thumbnails must be uploaded using FromReader, see the API documentation
+// for limitations.
+func (od *OutgoingDocument) SetThumbnail(to InputFile) *OutgoingDocument {
+	od.thumbnail = &to
+	return od
+}
+
+// isUpload checks whether the file or its thumbnail are uploaded.
+func (od *OutgoingDocument) isUpload() bool {
+	return od.outgoingFileBase.isUpload() || od.outgoingThumbnailBase.isUpload()
 }
 
 // querystring implements querystringer to represent the outgoing file.
@@ -294,6 +417,14 @@ type OutgoingPhoto struct {
 	Caption string `json:"caption,omitempty"`
 }
 
+// SetProgressFunc sets a function to be called with the progress of the
+// upload of the photo (optional).
+// It is only called if the file is uploaded from a reader.
+func (op *OutgoingPhoto) SetProgressFunc(to ProgressFunc) *OutgoingPhoto {
+	op.progress = to
+	return op
+}
+
 // SetCaption sets a caption for the photo (optional).
 func (op *OutgoingPhoto) SetCaption(to string) *OutgoingPhoto {
 	op.Caption = to
@@ -317,11 +448,24 @@ type OutgoingSticker struct {
 	outgoingFileBase
 }
 
+// SetProgressFunc sets a function to be called with the progress of the
+// upload of the sticker (optional).
+// It is only called if the file is uploaded from a reader.
+func (os *OutgoingSticker) SetProgressFunc(to ProgressFunc) *OutgoingSticker {
+	os.progress = to
+	return os
+}
+
 // querystring implements querystringer to represent the sticker message.
 func (os *OutgoingSticker) querystring() querystring {
 	return os.getBaseQueryString()
 }
 
+type outgoingGetChatMember struct {
+	Recipient Recipient `json:"chat_id"`
+	UserID    int       `json:"user_id"`
+}
+
 // OutgoingKickChatMember represents a request to kick a chat member.
 type OutgoingKickChatMember struct {
 	api       *TelegramBotAPI
@@ -385,10 +529,32 @@ func (op *OutgoingUserProfilePhotosRequest) querystring() querystring {
 type OutgoingVideo struct {
 	outgoingMessageBase
 	outgoingFileBase
+	outgoingThumbnailBase
 	Duration int    `json:"duration,omitempty"`
 	Caption  string `json:"caption,omitempty"`
 }
 
+// SetProgressFunc sets a function to be called with the progress of the
+// upload of the video file (optional).
+// It is only called if the file is uploaded from a reader.
+func (ov *OutgoingVideo) SetProgressFunc(to ProgressFunc) *OutgoingVideo {
+	ov.progress = to
+	return ov
+}
+
+// SetThumbnail sets a thumbnail for the video file (optional).
+// Thumbnails must be uploaded using FromReader, see the API documentation
+// for limitations.
+func (ov *OutgoingVideo) SetThumbnail(to InputFile) *OutgoingVideo {
+	ov.thumbnail = &to
+	return ov
+}
+
+// isUpload checks whether the video file or its thumbnail are uploaded.
+func (ov *OutgoingVideo) isUpload() bool {
+	return ov.outgoingFileBase.isUpload() || ov.outgoingThumbnailBase.isUpload()
+}
+
 // SetCaption sets a caption for the video file (optional).
 func (ov *OutgoingVideo) SetCaption(to string) *OutgoingVideo {
 	ov.Caption = to
@@ -424,6 +590,14 @@ type OutgoingVoice struct {
 	Duration int `json:"duration,omitempty"`
 }
 
+// SetProgressFunc sets a function to be called with the progress of the
+// upload of the voice note (optional).
+// It is only called if the file is uploaded from a reader.
+func (ov *OutgoingVoice) SetProgressFunc(to ProgressFunc) *OutgoingVoice {
+	ov.progress = to
+	return ov
+}
+
 // SetDuration sets a duration of the voice note (optional).
 func (ov *OutgoingVoice) SetDuration(to int) *OutgoingVoice {
 	ov.Duration = to
@@ -0,0 +1,142 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PollConfig configures long polling for updates.
+type PollConfig struct {
+	// Timeout is the time the API waits for updates before it answers a
+	// poll with no updates. It is rounded down to whole seconds.
+	Timeout time.Duration
+
+	// Limit is the maximum number of updates retrieved by one poll.
+	// Zero leaves it up to the API, which currently means 100.
+	Limit int
+
+	// AllowedUpdates are the types of updates to be retrieved.
+	// A nil slice keeps the setting of the previous poll, which is
+	// remembered by the API; an empty slice retrieves all types.
+	AllowedUpdates []UpdateType
+}
+
+// updateTypeNames are the names the API uses for update types in
+// allowed_updates.
+var updateTypeNames = map[UpdateType]string{
+	MessageUpdate:            "message",
+	InlineQueryUpdate:        "inline_query",
+	ChosenInlineResultUpdate: "chosen_inline_result",
+	CallbackQueryUpdate:      "callback_query",
+}
+
+// PollConfig returns the current long polling configuration.
+func (api *TelegramBotAPI) PollConfig() PollConfig {
+	api.pollMu.Lock()
+	defer api.pollMu.Unlock()
+
+	return api.poll
+}
+
+// SetPollConfig changes the long polling configuration.
+// The change takes effect with the next poll.
+func (api *TelegramBotAPI) SetPollConfig(cfg PollConfig) {
+	api.pollMu.Lock()
+	defer api.pollMu.Unlock()
+
+	api.poll = cfg
+}
+
+// GetUpdates performs one long poll for updates, for bots that run their
+// own update loop instead of consuming the Updates channel. Such bots
+// should be created with WithoutAutoStart.
+//
+// Updates with IDs lower than offset are confirmed and not returned
+// anymore, an offset of zero returns all unconfirmed updates.
+// limit and allowed work like PollConfig.Limit and
+// PollConfig.AllowedUpdates.
+// The updates are returned sorted by ID.
+func (api *TelegramBotAPI) GetUpdates(ctx context.Context, offset, limit int, timeout time.Duration, allowed []UpdateType) ([]Update, error) {
+	resp, err := api.getUpdatesWith(ctx, api.c, offset, limit, timeout, allowed)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Update, nil
+}
+
+// getUpdatesWith performs one poll using the given client.
+func (api *TelegramBotAPI) getUpdatesWith(ctx context.Context, c *client, offset, limit int, timeout time.Duration, allowed []UpdateType) (*updateResponse, error) {
+	querystring := map[string]string{"timeout": fmt.Sprint(int(timeout / time.Second))}
+	if limit > 0 {
+		querystring["limit"] = fmt.Sprint(limit)
+	}
+	if offset != 0 {
+		querystring["offset"] = fmt.Sprint(offset)
+	}
+	if allowed != nil {
+		b, err := allowedUpdatesJSON(allowed)
+		if err != nil {
+			return nil, err
+		}
+		querystring["allowed_updates"] = b
+	}
+
+	resp := &updateResponse{}
+	err := c.getQuerystring(ctx, getUpdates, resp, querystring)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.sort()
+	return resp, nil
+}
+
+// minPollBackoff is the wait between failed polls if the retry policy
+// never returned a longer one.
+const minPollBackoff = time.Second
+
+// pollBackoff returns how long the update loop waits before it polls again
+// after failures failed polls in a row, the last one with err.
+// Polling is never given up: once the policy gives up, the longest wait it
+// returned, passed as longest, is kept.
+// If the API asked to retry after some time, at least that long is waited.
+func (api *TelegramBotAPI) pollBackoff(failures int, err error, longest time.Duration) time.Duration {
+	wait, ok := api.pollRetry.Backoff(failures)
+	if !ok {
+		wait = longest
+		if wait < minPollBackoff {
+			wait = minPollBackoff
+		}
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter() > wait {
+		wait = apiErr.RetryAfter()
+	}
+	return wait
+}
+
+// allowedUpdatesJSON encodes update types as a JSON array of their names.
+func allowedUpdatesJSON(allowed []UpdateType) (string, error) {
+	names := make([]string, 0, len(allowed))
+	for _, t := range allowed {
+		name, ok := updateTypeNames[t]
+		if !ok {
+			return "", fmt.Errorf("tbotapi: update type %s cannot be requested", t)
+		}
+		names = append(names, name)
+	}
+
+	b, err := json.Marshal(names)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
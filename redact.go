@@ -0,0 +1,39 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+)
+
+// redacted replaces bot tokens in redacted strings.
+const redacted = "<redacted>"
+
+// tokenPattern matches the token part of API and file URLs, as in
+// https://api.telegram.org/bot123456:ABC-DEF/getMe.
+var tokenPattern = regexp.MustCompile(`(/bot)[0-9]+:[A-Za-z0-9_-]+`)
+
+// RedactURL returns rawURL with the bot token replaced by "<redacted>".
+// Strings that are not URLs are redacted just the same, so RedactURL can be
+// used on error messages and log lines as well.
+func RedactURL(rawURL string) string {
+	return tokenPattern.ReplaceAllString(rawURL, "$1"+redacted)
+}
+
+// redactError removes the bot token from errors returned by the HTTP
+// client, which contain the URL of the request.
+func redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return &url.Error{
+			Op:  urlErr.Op,
+			URL: RedactURL(urlErr.URL),
+			Err: urlErr.Err,
+		}
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+const secret = "TEST-token_for_tbotapitest"
+
+// assertNoToken fails if err or any error it wraps mentions the token.
+func assertNoToken(t *testing.T, err error) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		for _, s := range []string{e.Error(), fmt.Sprintf("%+v", e), fmt.Sprintf("%#v", e)} {
+			if strings.Contains(s, secret) {
+				t.Errorf("error leaks the token: %s", s)
+			}
+		}
+	}
+}
+
+func TestErrorsDoNotLeakToken(t *testing.T) {
+	closedSrv := httptest.NewServer(http.NotFoundHandler())
+	closedSrv.Close()
+
+	htmlSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "<html>%s not found</html>", r.URL.Path)
+	}))
+	defer htmlSrv.Close()
+
+	serverErrSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, r.URL.Path, http.StatusBadGateway)
+	}))
+	defer serverErrSrv.Close()
+
+	tests := []struct {
+		name    string
+		baseURL string
+	}{
+		{"invalid URL", "http://bad host"},
+		{"connection refused", closedSrv.URL},
+		{"not JSON", htmlSrv.URL},
+		{"server error", serverErrSrv.URL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tbotapi.NewWithOptions(tbotapitest.DefaultToken,
+				tbotapi.WithBaseURL(tt.baseURL),
+				tbotapi.WithRetryPolicy(nil))
+			assertNoToken(t, err)
+
+			var transportErr *tbotapi.TransportError
+			if !errors.As(err, &transportErr) {
+				t.Errorf("got %T, want a *TransportError", err)
+			}
+		})
+	}
+}
+
+func TestUpdateErrorsDoNotLeakToken(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	hookErrs := make(chan error, 1)
+	api, err := s.NewBot(tbotapi.WithRetryHook(func(method string, attempt int, err error, wait time.Duration) {
+		select {
+		case hookErrs <- err:
+		default:
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	s.Fail("getUpdates", tbotapitest.ServerError(http.StatusBadGateway))
+
+	u := <-api.Updates
+	assertNoToken(t, u.Error())
+	assertNoToken(t, <-hookErrs)
+}
+
+func TestLoggingMiddlewareDoesNotLeakToken(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	api, err := s.NewBot(tbotapi.WithoutAutoStart(),
+		tbotapi.WithMiddleware(tbotapi.LoggingMiddleware(l)),
+		tbotapi.WithRetryPolicy(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	s.Fail("getFile", tbotapitest.ServerError(http.StatusInternalServerError))
+	_, err = api.GetFile("some-file")
+	assertNoToken(t, err)
+
+	if !strings.Contains(buf.String(), "call failed") {
+		t.Errorf("failed call not logged: %s", buf)
+	}
+	if strings.Contains(buf.String(), secret) {
+		t.Errorf("log leaks the token: %s", buf)
+	}
+}
+
+func TestFormattingDoesNotLeakToken(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	api, err := s.NewBot(tbotapi.WithoutAutoStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if out := fmt.Sprintf(format, api); strings.Contains(out, secret) {
+			t.Errorf("%s leaks the token: %s", format, out)
+		}
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{
+			"https://api.telegram.org/bot123456:ABC-def_ghi/getMe",
+			"https://api.telegram.org/bot<redacted>/getMe",
+		},
+		{
+			"https://api.telegram.org/file/bot123456:ABC-def_ghi/photos/file_1.jpg",
+			"https://api.telegram.org/file/bot<redacted>/photos/file_1.jpg",
+		},
+		{
+			`Get "http://localhost/bot1:x/getUpdates?timeout=1": EOF`,
+			`Get "http://localhost/bot<redacted>/getUpdates?timeout=1": EOF`,
+		},
+		{
+			"https://example.com/robots.txt",
+			"https://example.com/robots.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tbotapi.RedactURL(tt.in); got != tt.want {
+			t.Errorf("RedactURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -5,117 +5,390 @@
 package tbotapi
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
-
-	"gopkg.in/resty.v0"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
+// method is the name of a Bot API method, as used in the URL.
 type method string
 
 const (
-	getMe                = method("GetMe")
-	sendMessage          = method("SendMessage")
-	forwardMessage       = method("ForwardMessage")
-	sendPhoto            = method("SendPhoto")
-	sendAudio            = method("SendAudio")
-	sendDocument         = method("SendDocument")
-	sendSticker          = method("SendSticker")
-	sendVideo            = method("SendVideo")
-	sendVoice            = method("SendVoice")
-	sendLocation         = method("SendLocation")
-	sendVenue            = method("SendVenue")
-	sendChatAction       = method("SendChatAction")
-	getUserProfilePhotos = method("GetUserProfilePhotos")
-	getUpdates           = method("GetUpdates")
-	setWebhook           = method("SetWebhook")
-	getFile              = method("GetFile")
-	answerInlineQuery    = method("AnswerInlineQuery")
-	kickChatMember       = method("KickChatMember")
-	unbanChatMember      = method("UnbanChatMember")
-	answerCallbackQuery  = method("AnswerCallbackQuery")
+	getMe                = method("getMe")
+	sendMessage          = method("sendMessage")
+	forwardMessage       = method("forwardMessage")
+	sendPhoto            = method("sendPhoto")
+	sendAudio            = method("sendAudio")
+	sendDocument         = method("sendDocument")
+	sendSticker          = method("sendSticker")
+	sendVideo            = method("sendVideo")
+	sendVoice            = method("sendVoice")
+	sendLocation         = method("sendLocation")
+	sendVenue            = method("sendVenue")
+	sendChatAction       = method("sendChatAction")
+	getUserProfilePhotos = method("getUserProfilePhotos")
+	getUpdates           = method("getUpdates")
+	setWebhook           = method("setWebhook")
+	deleteWebhook        = method("deleteWebhook")
+	getWebhookInfo       = method("getWebhookInfo")
+	getFile              = method("getFile")
+	answerInlineQuery    = method("answerInlineQuery")
+	kickChatMember       = method("kickChatMember")
+	unbanChatMember      = method("unbanChatMember")
+	answerCallbackQuery  = method("answerCallbackQuery")
+	getChatMember        = method("getChatMember")
 )
 
+// methodInfo describes a known Bot API method.
+type methodInfo struct {
+	idempotent bool // Whether the method can safely be repeated.
+}
+
+// methods is the registry of known Bot API methods.
+// Methods not contained in here can still be called, but are treated as
+// not idempotent.
+var methods = map[method]methodInfo{
+	getMe:                {idempotent: true},
+	sendMessage:          {},
+	forwardMessage:       {},
+	sendPhoto:            {},
+	sendAudio:            {},
+	sendDocument:         {},
+	sendSticker:          {},
+	sendVideo:            {},
+	sendVoice:            {},
+	sendLocation:         {},
+	sendVenue:            {},
+	sendChatAction:       {idempotent: true},
+	getUserProfilePhotos: {idempotent: true},
+	getUpdates:           {idempotent: true},
+	setWebhook:           {idempotent: true},
+	deleteWebhook:        {idempotent: true},
+	getWebhookInfo:       {idempotent: true},
+	getFile:              {idempotent: true},
+	answerInlineQuery:    {},
+	kickChatMember:       {idempotent: true},
+	unbanChatMember:      {idempotent: true},
+	answerCallbackQuery:  {},
+	getChatMember:        {idempotent: true},
+}
+
+func (m method) idempotent() bool {
+	return methods[m].idempotent
+}
+
 type client struct {
-	c         *resty.Client
-	endpoints map[method]string
+	c           *http.Client
+	baseURI     string
+	rt          RoundTripper // The middleware chain, ending in transport.
+	retryPolicy RetryPolicy
+	retryHook   RetryHook
+	metrics     Metrics         // May be nil.
+	closed      <-chan struct{} // Stops retries once closed.
 }
 
-func newClient(baseURI string) *client {
+func newClient(baseURI string, o *options, closed <-chan struct{}) *client {
+	c := o.httpClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	mw := o.middleware
+	if o.metrics != nil {
+		mw = append(mw[:len(mw):len(mw)], metricsMiddleware(o.metrics))
+	}
+
 	toReturn := &client{
-		c:         resty.New().SetHTTPMode().OnAfterResponse(parseResponseBody).OnAfterResponse(checkHTTPStatus),
-		endpoints: createEndpoints(baseURI),
+		c:           c,
+		baseURI:     baseURI,
+		rt:          chain(transport, mw),
+		retryPolicy: o.retryPolicy,
+		retryHook:   o.retryHook,
+		metrics:     o.metrics,
+		closed:      closed,
 	}
 
 	return toReturn
 }
 
-func (c *client) get(m method, result interface{}) (*resty.Response, error) {
-	return c.c.R().SetResult(result).Get(c.getEndpoint(m))
+func (c *client) get(ctx context.Context, m method, result interface{}) error {
+	return c.getQuerystring(ctx, m, result, nil)
 }
 
-func (c *client) getQuerystring(m method, result interface{}, querystring map[string]string) (*resty.Response, error) {
-	return c.c.R().SetQueryParams(querystring).SetResult(result).Get(c.getEndpoint(m))
+func (c *client) getQuerystring(ctx context.Context, m method, result interface{}, querystring map[string]string) error {
+	return c.retry(ctx, m, func() error {
+		return c.roundTrip(ctx, m, querystring, nil, result, func(ctx context.Context, r *Request) error {
+			querystring, err := r.fields()
+			if err != nil {
+				return err
+			}
+
+			endpoint := c.getEndpoint(m)
+			if len(querystring) > 0 {
+				values := url.Values{}
+				for k, v := range querystring {
+					values.Set(k, v)
+				}
+				endpoint += "?" + values.Encode()
+			}
+
+			req, err := c.newRequest(ctx, m, http.MethodGet, endpoint, nil)
+			if err != nil {
+				return err
+			}
+			r.setHeader(req)
+			return c.do(m, req, result)
+		})
+	})
 }
 
-func (c *client) postJSON(m method, result interface{}, data interface{}) (*resty.Response, error) {
-	return c.c.R().SetBody(data).SetResult(result).Post(c.getEndpoint(m))
+func (c *client) postJSON(ctx context.Context, m method, result interface{}, data interface{}) error {
+	return c.retry(ctx, m, func() error {
+		return c.roundTrip(ctx, m, data, nil, result, func(ctx context.Context, r *Request) error {
+			body, err := json.Marshal(r.Params)
+			if err != nil {
+				return err
+			}
+
+			req, err := c.newRequest(ctx, m, http.MethodPost, c.getEndpoint(m), bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			r.setHeader(req)
+			req.Header.Set("Content-Type", "application/json")
+			return c.do(m, req, result)
+		})
+	})
 }
 
-func (c *client) uploadFile(m method, result interface{}, data file, fields querystringer) (*resty.Response, error) {
-	return c.c.R().SetFileReader(data.fieldName, data.fileName, data.r).SetResult(result).SetFormData(map[string]string(fields.querystring())).Post(c.getEndpoint(m))
+func (c *client) postForm(ctx context.Context, m method, result interface{}, fields querystring) error {
+	return c.retry(ctx, m, func() error {
+		return c.roundTrip(ctx, m, map[string]string(fields), nil, result, func(ctx context.Context, r *Request) error {
+			fields, err := r.fields()
+			if err != nil {
+				return err
+			}
+
+			values := url.Values{}
+			for k, v := range fields {
+				values.Set(k, v)
+			}
+
+			req, err := c.newRequest(ctx, m, http.MethodPost, c.getEndpoint(m), strings.NewReader(values.Encode()))
+			if err != nil {
+				return err
+			}
+			r.setHeader(req)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return c.do(m, req, result)
+		})
+	})
 }
 
-func parseResponseBody(c *resty.Client, res *resty.Response) (err error) {
-	// Handles only JSON.
-	ct := res.Header().Get(http.CanonicalHeaderKey("Content-Type"))
-	if resty.IsJSONType(ct) {
-		// Considered as Result.
-		if res.StatusCode() > 199 && res.StatusCode() < 500 {
-			if res.Request.Result != nil {
-				err = json.Unmarshal(res.Body(), res.Request.Result)
+// uploadFile posts the fields and the files as multipart/form-data.
+// The body is streamed, so files are never held in memory as a whole.
+// Uploads are never repeated, because readers can only be consumed once.
+func (c *client) uploadFile(ctx context.Context, m method, result interface{}, files []file, fields querystring) error {
+	return c.roundTrip(ctx, m, map[string]string(fields), files, result, func(ctx context.Context, r *Request) error {
+		fields, err := r.fields()
+		if err != nil {
+			return err
+		}
+
+		pr, pw := io.Pipe()
+		defer pr.Close() // Unblocks the writer, should the request fail early.
+		mw := multipart.NewWriter(pw)
+
+		go func() {
+			n, err := writeMultipart(mw, files, fields)
+			if c.metrics != nil {
+				c.metrics.AddUploadBytes(string(m), n)
 			}
+			pw.CloseWithError(err)
+		}()
+
+		req, err := c.newRequest(ctx, m, http.MethodPost, c.getEndpoint(m), pr)
+		if err != nil {
+			return err
 		}
+		r.setHeader(req)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		return c.do(m, req, result)
+	})
+}
+
+// roundTrip passes a request through the middleware chain.
+func (c *client) roundTrip(ctx context.Context, m method, params interface{}, files []file, result interface{}, send func(ctx context.Context, req *Request) error) error {
+	req := &Request{
+		Method: string(m),
+		Params: params,
+		Header: http.Header{},
+		Result: result,
+		send:   send,
+	}
+	for _, f := range files {
+		req.Files = append(req.Files, RequestFile{FieldName: f.fieldName, FileName: f.fileName})
 	}
 
-	return
+	return c.rt.RoundTrip(ctx, req)
 }
 
-func checkHTTPStatus(_ *resty.Client, res *resty.Response) error {
-	if res.StatusCode() >= 500 {
-		return fmt.Errorf("API: Server error: returned %s when requesting %s", res.Status(), res.Request.URL)
+// writeMultipart writes the fields and files to mw and returns the number
+// of file bytes written.
+func writeMultipart(mw *multipart.Writer, files []file, fields querystring) (int64, error) {
+	var total int64
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err := mw.WriteField(k, fields[k])
+		if err != nil {
+			return total, err
+		}
 	}
+
+	for _, f := range files {
+		part, err := mw.CreateFormFile(f.fieldName, f.fileName)
+		if err != nil {
+			return total, err
+		}
+
+		r := f.r
+		if f.progress != nil {
+			r = newProgressReader(r, f.progress)
+		}
+
+		n, err := io.Copy(part, r)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, mw.Close()
+}
+
+// newRequest creates an HTTP request for the given method.
+// Errors are wrapped in a *TransportError.
+func (c *client) newRequest(ctx context.Context, m method, httpMethod, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, httpMethod, endpoint, body)
+	if err != nil {
+		return nil, &TransportError{Method: string(m), Err: redactError(err), permanent: true}
+	}
+	return req, nil
+}
+
+// do performs the request and decodes the response into result.
+// All errors are wrapped in a *TransportError.
+func (c *client) do(m method, req *http.Request, result interface{}) error {
+	res, err := c.c.Do(req)
+	if err != nil {
+		return &TransportError{Method: string(m), Err: redactError(err)}
+	}
+	defer func() {
+		// Drain the body so that the connection can be reused.
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	err = checkHTTPStatus(res)
+	if err == nil {
+		err = parseResponseBody(res, result)
+	}
+	if err != nil {
+		return &TransportError{Method: string(m), StatusCode: res.StatusCode, Err: err}
+	}
+
 	return nil
 }
 
-func (c *client) getEndpoint(method method) string {
-	endpoint, ok := c.endpoints[method]
-	if !ok {
-		panic(fmt.Errorf("tbotapi: internal: Endpoint for method %s not found", string(method)))
+// retry performs a request and, if the method is idempotent, repeats it
+// according to the retry policy for as long as it fails with a
+// *TransportError that is not permanent.
+func (c *client) retry(ctx context.Context, m method, do func() error) error {
+	err := do()
+
+	for attempt := 1; err != nil && m.idempotent() && c.retryPolicy != nil && ctx.Err() == nil; attempt++ {
+		var transportErr *TransportError
+		if !errors.As(err, &transportErr) || transportErr.permanentError() {
+			break
+		}
+
+		wait, ok := c.retryPolicy.Backoff(attempt)
+		if !ok {
+			break
+		}
+		if c.retryHook != nil {
+			c.retryHook(string(m), attempt, err, wait)
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-c.closed:
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		err = do()
 	}
-	return endpoint
+
+	return err
 }
 
-func createEndpoints(baseURI string) map[method]string {
-	toReturn := map[method]string{}
+// parseResponseBody decodes JSON responses into result.
+// Other responses, like an HTML error page from a proxy or a wrong base
+// URL, are errors.
+func parseResponseBody(res *http.Response, result interface{}) error {
+	// Handles only JSON.
+	if !isJSONType(res.Header.Get("Content-Type")) {
+		return fmt.Errorf("API: unexpected response: returned %s with content type %q", res.Status, res.Header.Get("Content-Type"))
+	}
 
-	toReturn[getMe] = fmt.Sprint(baseURI, "/", string(getMe))
-	toReturn[sendMessage] = fmt.Sprint(baseURI, "/", string(sendMessage))
-	toReturn[forwardMessage] = fmt.Sprint(baseURI, "/", string(forwardMessage))
-	toReturn[sendPhoto] = fmt.Sprint(baseURI, "/", string(sendPhoto))
-	toReturn[sendAudio] = fmt.Sprint(baseURI, "/", string(sendAudio))
-	toReturn[sendDocument] = fmt.Sprint(baseURI, "/", string(sendDocument))
-	toReturn[sendSticker] = fmt.Sprint(baseURI, "/", string(sendSticker))
-	toReturn[sendVideo] = fmt.Sprint(baseURI, "/", string(sendVideo))
-	toReturn[sendVoice] = fmt.Sprint(baseURI, "/", string(sendVoice))
-	toReturn[sendLocation] = fmt.Sprint(baseURI, "/", string(sendLocation))
-	toReturn[sendChatAction] = fmt.Sprint(baseURI, "/", string(sendChatAction))
-	toReturn[getUserProfilePhotos] = fmt.Sprint(baseURI, "/", string(getUserProfilePhotos))
-	toReturn[getUpdates] = fmt.Sprint(baseURI, "/", string(getUpdates))
-	toReturn[setWebhook] = fmt.Sprint(baseURI, "/", string(setWebhook))
-	toReturn[getFile] = fmt.Sprint(baseURI, "/", string(getFile))
-	toReturn[answerInlineQuery] = fmt.Sprint(baseURI, "/", string(answerInlineQuery))
+	// Considered as Result.
+	if res.StatusCode > 199 && res.StatusCode < 500 && result != nil {
+		return json.NewDecoder(res.Body).Decode(result)
+	}
 
-	return toReturn
+	return nil
+}
+
+func isJSONType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func checkHTTPStatus(res *http.Response) error {
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("API: Server error: returned %s when requesting %s", res.Status, RedactURL(res.Request.URL.String()))
+	}
+	return nil
+}
+
+// getEndpoint builds the URL for the given method.
+func (c *client) getEndpoint(m method) string {
+	return c.baseURI + "/" + string(m)
 }
@@ -0,0 +1,98 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newBenchClient returns a client for a server answering every request
+// with body, after reading the request body completely.
+func newBenchClient(b *testing.B, body []byte) *client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	b.Cleanup(srv.Close)
+
+	o := defaultOptions()
+	o.retryPolicy = nil
+	return newClient(srv.URL+"/bot123:abc", o, make(chan struct{}))
+}
+
+// zeroReader is an endless reader of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// BenchmarkUploadFile measures the memory needed to upload files of
+// different sizes. As uploads are streamed, the bytes allocated per
+// operation must not grow with the file size.
+func BenchmarkUploadFile(b *testing.B) {
+	for _, size := range []int64{1 << 10, 1 << 20, 50 << 20} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			c := newBenchClient(b, []byte(`{"ok":true,"result":true}`))
+			fields := querystring{"chat_id": "1"}
+			b.SetBytes(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				files := []file{{
+					fieldName: "video",
+					fileName:  "video.mp4",
+					r:         io.LimitReader(zeroReader{}, size),
+				}}
+				err := c.uploadFile(context.Background(), sendVideo, &baseResponse{}, files, fields)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetUpdates measures decoding a full batch of 100 updates.
+func BenchmarkGetUpdates(b *testing.B) {
+	var updates []json.RawMessage
+	for i := 1; i <= 100; i++ {
+		updates = append(updates, json.RawMessage(fmt.Sprintf(
+			`{"update_id":%d,"message":{"message_id":%d,"date":1500000000,"chat":{"id":42,"type":"private"},"from":{"id":42,"first_name":"Test"},"text":"Hello, World!"}}`,
+			i, i)))
+	}
+	body, err := json.Marshal(map[string]interface{}{"ok": true, "result": updates})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	c := newBenchClient(b, body)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		result := &updateResponse{}
+		err := c.getQuerystring(context.Background(), getUpdates, result, map[string]string{"timeout": "0"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(result.Update) != 100 {
+			b.Fatalf("got %d updates, want 100", len(result.Update))
+		}
+	}
+}
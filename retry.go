@@ -0,0 +1,108 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// A RetryPolicy decides whether and when a failed request is repeated.
+//
+// Only requests that failed with a *TransportError are repeated, and only
+// if they are safe to repeat, i.e. long polling and idempotent calls like
+// GetMe, GetFile or chat actions. Messages are never repeated, because a
+// failed request may still have been delivered. Requests that could not be
+// created or were answered with a 4xx status that was not JSON are not
+// repeated either, because that does not help.
+type RetryPolicy interface {
+	// Backoff returns how long to wait before repeating a request that
+	// failed attempt times in a row, or false if it should not be
+	// repeated.
+	Backoff(attempt int) (time.Duration, bool)
+}
+
+// A RetryHook is called before every repeated request.
+type RetryHook func(method string, attempt int, err error, wait time.Duration)
+
+// ExponentialBackoff is a RetryPolicy that multiplies the time to wait
+// with every failed attempt.
+type ExponentialBackoff struct {
+	Initial     time.Duration // Time to wait after the first failure.
+	Max         time.Duration // Upper bound for the time to wait, or zero for no bound but the largest Duration.
+	Multiplier  float64       // Factor to multiply the time to wait with on every failure. If zero, 2 is used.
+	Jitter      float64       // Fraction of the time to wait that is randomized, between 0 and 1.
+	MaxAttempts int           // Maximum number of attempts, including the first one, or zero for no limit.
+}
+
+// DefaultRetryPolicy is the RetryPolicy used if none is configured.
+var DefaultRetryPolicy = ExponentialBackoff{
+	Initial:     time.Second,
+	Max:         time.Minute,
+	Multiplier:  2,
+	Jitter:      0.5,
+	MaxAttempts: 10,
+}
+
+// Backoff implements RetryPolicy.
+func (b ExponentialBackoff) Backoff(attempt int) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt >= b.MaxAttempts {
+		return 0, false
+	}
+
+	multiplier := b.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	limit := float64(math.MaxInt64)
+	if b.Max > 0 {
+		limit = float64(b.Max)
+	}
+
+	// Clamp before converting, the product overflows a Duration after a
+	// few dozen attempts. This also catches +Inf and NaN.
+	wait := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if !(wait < limit) {
+		wait = limit
+	}
+	if b.Jitter > 0 {
+		wait -= wait * b.Jitter * rand.Float64()
+	}
+	if wait < 0 {
+		wait = 0
+	}
+
+	// float64(math.MaxInt64) is rounded up to 1<<63, which does not fit.
+	if wait >= float64(math.MaxInt64) {
+		return math.MaxInt64, true
+	}
+	return time.Duration(wait), true
+}
+
+// WithRetryPolicy sets the RetryPolicy used for long polling and
+// idempotent requests.
+// A nil policy disables retries of requests.
+// The default is DefaultRetryPolicy.
+//
+// Long polling is never given up. Failed polls, whatever the error, are
+// repeated after the time returned by the policy for the number of polls
+// that failed in a row, or at least after the time the API asked for.
+// Once the policy gives up, the longest time it returned is kept. If the
+// policy is nil, DefaultRetryPolicy is used for polling.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = p
+	}
+}
+
+// WithRetryHook sets a function to be called before every repeated
+// request, for example to log retries.
+func WithRetryHook(h RetryHook) Option {
+	return func(o *options) {
+		o.retryHook = h
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	unbounded := ExponentialBackoff{Initial: time.Second}
+	tests := []struct {
+		name    string
+		b       ExponentialBackoff
+		attempt int
+		want    time.Duration
+		ok      bool
+	}{
+		{"first attempt", unbounded, 1, time.Second, true},
+		{"default multiplier", unbounded, 4, 8 * time.Second, true},
+		{"multiplier", ExponentialBackoff{Initial: time.Second, Multiplier: 3}, 3, 9 * time.Second, true},
+		{"capped", ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second}, 4, 5 * time.Second, true},
+		{"capped at large attempt", ExponentialBackoff{Initial: time.Second, Max: time.Minute}, 1 << 20, time.Minute, true},
+		{"unbounded at attempt 64", unbounded, 64, math.MaxInt64, true},
+		{"unbounded at attempt 1000", unbounded, 1000, math.MaxInt64, true},
+		{"unbounded at largest attempt", unbounded, math.MaxInt32, math.MaxInt64, true},
+		{"last attempt", ExponentialBackoff{Initial: time.Second, MaxAttempts: 3}, 2, 2 * time.Second, true},
+		{"given up", ExponentialBackoff{Initial: time.Second, MaxAttempts: 3}, 3, 0, false},
+		{"negative multiplier", ExponentialBackoff{Initial: time.Second, Multiplier: -2}, 2, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.b.Backoff(tt.attempt)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Backoff(%d) = %v, %t, want %v, %t", tt.name, tt.attempt, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		b        ExponentialBackoff
+		attempt  int
+		min, max time.Duration
+	}{
+		{"default policy", DefaultRetryPolicy, 3, 2 * time.Second, 4 * time.Second},
+		{"capped", DefaultRetryPolicy, 9, 30 * time.Second, time.Minute},
+		{"full jitter", ExponentialBackoff{Initial: time.Second, Jitter: 1}, 1, 0, time.Second},
+		{"unbounded", ExponentialBackoff{Initial: time.Second, Jitter: 0.5}, 100, math.MaxInt64 / 2, math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 1000; i++ {
+			got, ok := tt.b.Backoff(tt.attempt)
+			if !ok || got < tt.min || got > tt.max {
+				t.Errorf("%s: Backoff(%d) = %v, %t, want between %v and %v", tt.name, tt.attempt, got, ok, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	retryAfter := 30
+	tooMany := &APIError{ErrorCode: 429, Parameters: &ResponseParameters{RetryAfter: &retryAfter}}
+	policy := ExponentialBackoff{Initial: time.Second, MaxAttempts: 3}
+
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		failures int
+		err      error
+		longest  time.Duration
+		want     time.Duration
+	}{
+		{"policy", policy, 2, errors.New("failed"), time.Second, 2 * time.Second},
+		{"policy gave up", policy, 3, errors.New("failed"), 2 * time.Second, 2 * time.Second},
+		{"policy gave up at once", ExponentialBackoff{MaxAttempts: 1}, 1, errors.New("failed"), 0, minPollBackoff},
+		{"retry after", policy, 1, tooMany, 0, 30 * time.Second},
+		{"retry after shorter than policy", ExponentialBackoff{Initial: time.Minute}, 1, tooMany, 0, time.Minute},
+		{"long outage", ExponentialBackoff{Initial: time.Second}, 1 << 20, errors.New("failed"), math.MaxInt64, math.MaxInt64},
+		{"long outage capped", DefaultRetryPolicy, 1 << 20, errors.New("failed"), time.Minute, time.Minute},
+	}
+
+	for _, tt := range tests {
+		api := &TelegramBotAPI{pollRetry: tt.policy}
+		if got := api.pollBackoff(tt.failures, tt.err, tt.longest); got != tt.want {
+			t.Errorf("%s: pollBackoff(%d) = %v, want %v", tt.name, tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A HandlerFunc handles an update.
+type HandlerFunc func(ctx context.Context, api *TelegramBotAPI, update Update)
+
+// A Router dispatches updates to handlers.
+//
+// Handlers are registered for kinds of updates, like commands or callback
+// data prefixes. For every update, the first matching handler, in the order
+// of registration, is called. If no handler matches, the fallback handler
+// is called, if set.
+//
+// A Router is safe for concurrent use, handlers can be registered while
+// updates are dispatched.
+type Router struct {
+	mu         sync.RWMutex
+	routes     []route
+	fallback   HandlerFunc
+	onError    func(err error)
+	middleware []HandlerMiddleware
+}
+
+type route struct {
+	match   func(api *TelegramBotAPI, u *Update) bool
+	handler HandlerFunc
+}
+
+// NewRouter creates a new Router without any handlers.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers a handler for all updates for which match returns true.
+func (r *Router) Handle(match func(api *TelegramBotAPI, u *Update) bool, h HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.routes = append(r.routes, route{match: match, handler: h})
+}
+
+// HandleUpdateType registers a handler for all updates of the given type.
+func (r *Router) HandleUpdateType(t UpdateType, h HandlerFunc) {
+	r.Handle(func(_ *TelegramBotAPI, u *Update) bool {
+		return u.Type() == t
+	}, h)
+}
+
+// HandleMessageType registers a handler for messages of the given type.
+func (r *Router) HandleMessageType(t MessageType, h HandlerFunc) {
+	r.Handle(func(_ *TelegramBotAPI, u *Update) bool {
+		return u.Message != nil && u.Message.Type() == t
+	}, h)
+}
+
+// HandleCommand registers a handler for a bot command, like "/start", in
+// the text or caption of a message.
+// The leading slash is optional. Commands addressed to other bots, like
+// /start@other_bot, do not match.
+func (r *Router) HandleCommand(command string, h HandlerFunc) {
+	command = strings.TrimPrefix(command, "/")
+	r.Handle(func(api *TelegramBotAPI, u *Update) bool {
+		if u.Message == nil {
+			return false
+		}
+		c, ok := api.Command(u.Message)
+		return ok && strings.EqualFold(c.Name, command)
+	}, h)
+}
+
+// HandleCallbackPrefix registers a handler for callback queries whose data
+// starts with prefix.
+func (r *Router) HandleCallbackPrefix(prefix string, h HandlerFunc) {
+	r.Handle(func(_ *TelegramBotAPI, u *Update) bool {
+		return u.CallbackQuery != nil && strings.HasPrefix(u.CallbackQuery.Data, prefix)
+	}, h)
+}
+
+// HandleInlineQuery registers a handler for inline queries matching re.
+func (r *Router) HandleInlineQuery(re *regexp.Regexp, h HandlerFunc) {
+	r.Handle(func(_ *TelegramBotAPI, u *Update) bool {
+		return u.InlineQuery != nil && re.MatchString(u.InlineQuery.Query)
+	}, h)
+}
+
+// HandleChatType registers a handler for updates from chats of the given
+// type, like PrivateChatType.
+func (r *Router) HandleChatType(chatType string, h HandlerFunc) {
+	r.Handle(func(_ *TelegramBotAPI, u *Update) bool {
+		c := u.Chat()
+		return c != nil && c.Type == chatType
+	}, h)
+}
+
+// Fallback sets the handler for updates no other handler matches.
+func (r *Router) Fallback(h HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fallback = h
+}
+
+// OnError sets a function to be called with errors received instead of
+// updates. By default, they are ignored.
+func (r *Router) OnError(f func(err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onError = f
+}
+
+// HandleUpdate dispatches one update to the first matching handler.
+func (r *Router) HandleUpdate(ctx context.Context, api *TelegramBotAPI, u Update) {
+	r.mu.RLock()
+	h := r.fallback
+	for _, route := range r.routes {
+		if route.match(api, &u) {
+			h = route.handler
+			break
+		}
+	}
+	mw := r.middleware
+	r.mu.RUnlock()
+
+	if h != nil {
+		Chain(h, mw...)(ctx, api, u)
+	}
+}
+
+// Run consumes api.Updates and dispatches the updates, one at a time.
+// It blocks until api is closed.
+// To handle updates concurrently, pass HandleUpdate to a Dispatcher
+// instead.
+func (r *Router) Run(api *TelegramBotAPI) {
+	for u := range api.Updates {
+		if err := u.Error(); err != nil {
+			r.mu.RLock()
+			onError := r.onError
+			r.mu.RUnlock()
+
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+
+		r.HandleUpdate(context.Background(), api, u.Update())
+		u.Ack()
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/mrd0ll4r/tbotapi"
+)
+
+// message returns a text message from a chat of the given type.
+func message(text, chatType string) *tbotapi.Message {
+	m := &tbotapi.Message{}
+	m.Chat = tbotapi.Chat{ID: 1, Type: chatType}
+	m.Text = &text
+	return m
+}
+
+// photo returns a photo with a caption from a private chat.
+func photo(caption string) *tbotapi.Message {
+	m := &tbotapi.Message{}
+	m.Chat = tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}
+	m.Photo = &[]tbotapi.PhotoSize{}
+	m.Caption = &caption
+	return m
+}
+
+// named returns a handler appending name to handled.
+func named(handled *[]string, name string) tbotapi.HandlerFunc {
+	return func(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+		*handled = append(*handled, name)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var handled []string
+	r := tbotapi.NewRouter()
+	r.HandleCommand("start", named(&handled, "start"))
+	r.HandleCommand("/help", named(&handled, "help"))
+	r.HandleCommand("start", named(&handled, "start again"))
+	r.HandleCallbackPrefix("vote:", named(&handled, "vote"))
+	r.HandleInlineQuery(regexp.MustCompile(`^gif `), named(&handled, "gif"))
+	r.HandleChatType(tbotapi.GroupChatType, named(&handled, "group"))
+	r.HandleMessageType(tbotapi.PhotoMessage, named(&handled, "photo"))
+	r.Fallback(named(&handled, "fallback"))
+
+	api := &tbotapi.TelegramBotAPI{Username: "my_bot"}
+	tests := []struct {
+		name   string
+		update tbotapi.Update
+		want   string
+	}{
+		{"command", tbotapi.Update{Message: message("/start", tbotapi.PrivateChatType)}, "start"},
+		{"command for the bot", tbotapi.Update{Message: message("/Start@My_Bot now", tbotapi.PrivateChatType)}, "start"},
+		{"command for another bot", tbotapi.Update{Message: message("/start@other_bot", tbotapi.PrivateChatType)}, "fallback"},
+		{"command registered with slash", tbotapi.Update{Message: message("/help me", tbotapi.PrivateChatType)}, "help"},
+		{"unknown command", tbotapi.Update{Message: message("/stop", tbotapi.PrivateChatType)}, "fallback"},
+		{"text", tbotapi.Update{Message: message("start", tbotapi.PrivateChatType)}, "fallback"},
+		{"command in caption", tbotapi.Update{Message: photo("/help")}, "help"},
+		{"photo", tbotapi.Update{Message: photo("a cat")}, "photo"},
+		{"command in group", tbotapi.Update{Message: message("/start", tbotapi.GroupChatType)}, "start"},
+		{"text in group", tbotapi.Update{Message: message("hello", tbotapi.GroupChatType)}, "group"},
+		{"callback", tbotapi.Update{CallbackQuery: &tbotapi.CallbackQuery{Data: "vote:42"}}, "vote"},
+		{"callback with other prefix", tbotapi.Update{CallbackQuery: &tbotapi.CallbackQuery{Data: "veto:42"}}, "fallback"},
+		{"callback in group", tbotapi.Update{CallbackQuery: &tbotapi.CallbackQuery{Data: "vote:1", Message: message("Vote!", tbotapi.GroupChatType)}}, "vote"},
+		{"inline query", tbotapi.Update{InlineQuery: &tbotapi.InlineQuery{Query: "gif cats"}}, "gif"},
+		{"other inline query", tbotapi.Update{InlineQuery: &tbotapi.InlineQuery{Query: "cats"}}, "fallback"},
+		{"chosen inline result", tbotapi.Update{ChosenInlineResult: &tbotapi.ChosenInlineResult{}}, "fallback"},
+	}
+
+	for _, tt := range tests {
+		handled = nil
+		r.HandleUpdate(context.Background(), api, tt.update)
+		if !reflect.DeepEqual(handled, []string{tt.want}) {
+			t.Errorf("%s: handled by %v, want %s", tt.name, handled, tt.want)
+		}
+	}
+}
+
+func TestRouterWithoutFallback(t *testing.T) {
+	var handled []string
+	r := tbotapi.NewRouter()
+	r.HandleCommand("start", named(&handled, "start"))
+	r.Use(func(next tbotapi.HandlerFunc) tbotapi.HandlerFunc {
+		handled = append(handled, "middleware")
+		return next
+	})
+
+	r.HandleUpdate(context.Background(), &tbotapi.TelegramBotAPI{}, tbotapi.Update{Message: message("hello", tbotapi.PrivateChatType)})
+	if len(handled) != 0 {
+		t.Errorf("unmatched update handled by %v", handled)
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	var handled []string
+	mw := func(name string) tbotapi.HandlerMiddleware {
+		return func(next tbotapi.HandlerFunc) tbotapi.HandlerFunc {
+			return func(ctx context.Context, api *tbotapi.TelegramBotAPI, u tbotapi.Update) {
+				handled = append(handled, name+" before")
+				next(ctx, api, u)
+				handled = append(handled, name+" after")
+			}
+		}
+	}
+
+	r := tbotapi.NewRouter()
+	r.Use(mw("a"), mw("b"))
+	r.HandleCommand("start", named(&handled, "start"))
+	r.Fallback(named(&handled, "fallback"))
+	r.Use(mw("c"))
+
+	tests := []struct {
+		text    string
+		handler string
+	}{
+		{"/start", "start"},
+		{"hello", "fallback"},
+	}
+
+	for _, tt := range tests {
+		handled = nil
+		r.HandleUpdate(context.Background(), &tbotapi.TelegramBotAPI{}, tbotapi.Update{Message: message(tt.text, tbotapi.PrivateChatType)})
+
+		want := []string{"a before", "b before", "c before", tt.handler, "c after", "b after", "a after"}
+		if !reflect.DeepEqual(handled, want) {
+			t.Errorf("%s: calls = %v, want %v", tt.text, handled, want)
+		}
+	}
+
+	// Chain applies middleware in the same order.
+	handled = nil
+	tbotapi.Chain(named(&handled, "chained"), mw("a"), mw("b"))(context.Background(), nil, tbotapi.Update{})
+	want := []string{"a before", "b before", "chained", "b after", "a after"}
+	if !reflect.DeepEqual(handled, want) {
+		t.Errorf("Chain: calls = %v, want %v", handled, want)
+	}
+}
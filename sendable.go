@@ -4,32 +4,63 @@
 
 package tbotapi
 
+import (
+	"context"
+	"time"
+)
+
 type sendable interface {
 	Send() (*MessageResponse, error)
+	SendContext(ctx context.Context) (*MessageResponse, error)
+	recipient() Recipient
 }
 
 // Send sends the message.
 // On success, the sent message is returned as a MessageResponse.
 func (om *OutgoingMessage) Send() (*MessageResponse, error) {
-	return om.api.send(om)
+	return om.SendContext(context.Background())
+}
+
+// SendContext sends the message using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (om *OutgoingMessage) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return om.api.send(ctx, om)
 }
 
 // Send sends the location.
 // On success, the sent message is returned as a MessageResponse.
 func (ol *OutgoingLocation) Send() (*MessageResponse, error) {
-	return ol.api.send(ol)
+	return ol.SendContext(context.Background())
+}
+
+// SendContext sends the location using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (ol *OutgoingLocation) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return ol.api.send(ctx, ol)
 }
 
 // Send sends the venue.
 // On success, the sent message is returned as a MessageResponse.
 func (ol *OutgoingVenue) Send() (*MessageResponse, error) {
-	return ol.api.send(ol)
+	return ol.SendContext(context.Background())
+}
+
+// SendContext sends the venue using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (ol *OutgoingVenue) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return ol.api.send(ctx, ol)
 }
 
 // Send sends the forward.
 // On success, the sent message is returned as a MessageResponse.
 func (of *OutgoingForward) Send() (*MessageResponse, error) {
-	return of.api.send(of)
+	return of.SendContext(context.Background())
+}
+
+// SendContext sends the forward using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (of *OutgoingForward) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return of.api.send(ctx, of)
 }
 
 // Send sends the video.
@@ -38,7 +69,13 @@ func (of *OutgoingForward) Send() (*MessageResponse, error) {
 // documentation.
 // On success, the sent message is returned as a MessageResponse.
 func (ov *OutgoingVideo) Send() (*MessageResponse, error) {
-	return ov.api.send(ov)
+	return ov.SendContext(context.Background())
+}
+
+// SendContext sends the video using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (ov *OutgoingVideo) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return ov.api.send(ctx, ov)
 }
 
 // Send sends the photo.
@@ -47,7 +84,13 @@ func (ov *OutgoingVideo) Send() (*MessageResponse, error) {
 // documentation.
 // On success, the sent message is returned as a MessageResponse.
 func (op *OutgoingPhoto) Send() (*MessageResponse, error) {
-	return op.api.send(op)
+	return op.SendContext(context.Background())
+}
+
+// SendContext sends the photo using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (op *OutgoingPhoto) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return op.api.send(ctx, op)
 }
 
 // Send sends the sticker.
@@ -56,7 +99,13 @@ func (op *OutgoingPhoto) Send() (*MessageResponse, error) {
 // documentation.
 // On success, the sent message is returned as a MessageResponse.
 func (os *OutgoingSticker) Send() (*MessageResponse, error) {
-	return os.api.send(os)
+	return os.SendContext(context.Background())
+}
+
+// SendContext sends the sticker using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (os *OutgoingSticker) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return os.api.send(ctx, os)
 }
 
 // Send sends the audio.
@@ -65,7 +114,13 @@ func (os *OutgoingSticker) Send() (*MessageResponse, error) {
 // documentation.
 // On success, the sent message is returned as a MessageResponse.
 func (oa *OutgoingAudio) Send() (*MessageResponse, error) {
-	return oa.api.send(oa)
+	return oa.SendContext(context.Background())
+}
+
+// SendContext sends the audio using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (oa *OutgoingAudio) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return oa.api.send(ctx, oa)
 }
 
 // Send sends the voice message.
@@ -74,7 +129,13 @@ func (oa *OutgoingAudio) Send() (*MessageResponse, error) {
 // documentation.
 // On success, the sent message is returned as a MessageResponse.
 func (ov *OutgoingVoice) Send() (*MessageResponse, error) {
-	return ov.api.send(ov)
+	return ov.SendContext(context.Background())
+}
+
+// SendContext sends the voice message using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (ov *OutgoingVoice) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return ov.api.send(ctx, ov)
 }
 
 // Send sends the document.
@@ -83,84 +144,118 @@ func (ov *OutgoingVoice) Send() (*MessageResponse, error) {
 // documentation.
 // On success, the sent message is returned as a MessageResponse.
 func (od *OutgoingDocument) Send() (*MessageResponse, error) {
-	return od.api.send(od)
+	return od.SendContext(context.Background())
+}
+
+// SendContext sends the document using the provided context.
+// On success, the sent message is returned as a MessageResponse.
+func (od *OutgoingDocument) SendContext(ctx context.Context) (*MessageResponse, error) {
+	return od.api.send(ctx, od)
 }
 
 // Send sends the request.
 // On success, the photos are returned as a UserProfilePhotosResponse.
 func (op *OutgoingUserProfilePhotosRequest) Send() (*UserProfilePhotosResponse, error) {
+	return op.SendContext(context.Background())
+}
+
+// SendContext sends the request using the provided context.
+// On success, the photos are returned as a UserProfilePhotosResponse.
+func (op *OutgoingUserProfilePhotosRequest) SendContext(ctx context.Context) (*UserProfilePhotosResponse, error) {
 	resp := &UserProfilePhotosResponse{}
-	_, err := op.api.c.postJSON(getUserProfilePhotos, resp, op)
+	err := op.api.c.postJSON(ctx, getUserProfilePhotos, resp, op)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = check(&resp.baseResponse)
-	if err != nil {
-		return nil, err
-	}
 	return resp, nil
 }
 
 // Send sends the chat action.
 // On success, nil is returned.
 func (oc *OutgoingChatAction) Send() error {
-	resp := &baseResponse{}
-	_, err := oc.api.c.postJSON(sendChatAction, resp, oc)
+	return oc.SendContext(context.Background())
+}
 
-	if err != nil {
-		return err
-	}
+// SendContext sends the chat action using the provided context.
+// On success, nil is returned.
+func (oc *OutgoingChatAction) SendContext(ctx context.Context) error {
+	return oc.api.c.postJSON(ctx, sendChatAction, &baseResponse{}, oc)
+}
+
+// chatActionInterval is the interval in which KeepAlive repeats a chat
+// action. Clients display a chat action for five seconds.
+const chatActionInterval = 4 * time.Second
+
+// KeepAlive sends the chat action and keeps repeating it until the
+// returned stop function is called or the context is done, for example to
+// show ChatActionUploadVideo while a video is uploaded.
+// Errors sending the chat action are ignored.
+func (oc *OutgoingChatAction) KeepAlive(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		t := time.NewTicker(chatActionInterval)
+		defer t.Stop()
 
-	return check(resp)
+		for {
+			oc.SendContext(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
 }
 
 // Send sends the inline query answer.
 // On success, nil is returned.
 func (ia *InlineQueryAnswer) Send() error {
-	resp := &baseResponse{}
-	_, err := ia.api.c.postJSON(answerInlineQuery, resp, ia)
-
-	if err != nil {
-		return err
-	}
+	return ia.SendContext(context.Background())
+}
 
-	return check(resp)
+// SendContext sends the inline query answer using the provided context.
+// On success, nil is returned.
+func (ia *InlineQueryAnswer) SendContext(ctx context.Context) error {
+	return ia.api.c.postJSON(ctx, answerInlineQuery, &baseResponse{}, ia)
 }
 
 // Send sends the kick request.
 func (kr *OutgoingKickChatMember) Send() error {
-	resp := &baseResponse{}
-	_, err := kr.api.c.postJSON(kickChatMember, resp, kr)
-
-	if err != nil {
-		return err
-	}
+	return kr.SendContext(context.Background())
+}
 
-	return check(resp)
+// SendContext sends the kick request using the provided context.
+func (kr *OutgoingKickChatMember) SendContext(ctx context.Context) error {
+	return kr.api.c.postJSON(ctx, kickChatMember, &baseResponse{}, kr)
 }
 
 // Send sends the unban request.
 func (ub *OutgoingUnbanChatMember) Send() error {
-	resp := &baseResponse{}
-	_, err := ub.api.c.postJSON(unbanChatMember, resp, ub)
-
-	if err != nil {
-		return err
-	}
+	return ub.SendContext(context.Background())
+}
 
-	return check(resp)
+// SendContext sends the unban request using the provided context.
+func (ub *OutgoingUnbanChatMember) SendContext(ctx context.Context) error {
+	return ub.api.c.postJSON(ctx, unbanChatMember, &baseResponse{}, ub)
 }
 
 // Send sends the callback response.
 func (cbr *OutgoingCallbackQueryResponse) Send() error {
-	resp := &baseResponse{}
-	_, err := cbr.api.c.postJSON(answerCallbackQuery, resp, cbr)
-
-	if err != nil {
-		return err
-	}
+	return cbr.SendContext(context.Background())
+}
 
-	return check(resp)
+// SendContext sends the callback response using the provided context.
+func (cbr *OutgoingCallbackQueryResponse) SendContext(ctx context.Context) error {
+	return cbr.api.c.postJSON(ctx, answerCallbackQuery, &baseResponse{}, cbr)
 }
@@ -0,0 +1,402 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+)
+
+type handler func(s *Server, w http.ResponseWriter, r *http.Request, call Call)
+
+// handlers contains the implemented methods.
+var handlers = map[string]handler{
+	"getMe":                (*Server).getMe,
+	"getUpdates":           (*Server).getUpdates,
+	"setWebhook":           (*Server).setWebhook,
+	"deleteWebhook":        (*Server).deleteWebhook,
+	"getWebhookInfo":       (*Server).getWebhookInfo,
+	"sendMessage":          (*Server).sendMessage,
+	"forwardMessage":       (*Server).forwardMessage,
+	"sendPhoto":            (*Server).sendMedia,
+	"sendAudio":            (*Server).sendMedia,
+	"sendDocument":         (*Server).sendMedia,
+	"sendSticker":          (*Server).sendMedia,
+	"sendVideo":            (*Server).sendMedia,
+	"sendVoice":            (*Server).sendMedia,
+	"sendLocation":         (*Server).sendLocation,
+	"sendVenue":            (*Server).sendVenue,
+	"sendChatAction":       requireParams(true, "chat_id", "action"),
+	"getUserProfilePhotos": (*Server).getUserProfilePhotos,
+	"getFile":              (*Server).getFile,
+	"answerInlineQuery":    requireParams(true, "inline_query_id", "results"),
+	"answerCallbackQuery":  requireParams(true, "callback_query_id"),
+	"kickChatMember":       requireParams(true, "chat_id", "user_id"),
+	"unbanChatMember":      requireParams(true, "chat_id", "user_id"),
+	"getChatMember":        (*Server).getChatMember,
+}
+
+// mediaFields maps the media senders to the name of their file field.
+var mediaFields = map[string]string{
+	"sendPhoto":    "photo",
+	"sendAudio":    "audio",
+	"sendDocument": "document",
+	"sendSticker":  "sticker",
+	"sendVideo":    "video",
+	"sendVoice":    "voice",
+}
+
+// requireParams returns a handler that checks for the given parameters and
+// answers with result.
+func requireParams(result interface{}, names ...string) handler {
+	return func(s *Server, w http.ResponseWriter, r *http.Request, call Call) {
+		if !hasParams(w, call, names...) {
+			return
+		}
+		writeResult(w, result)
+	}
+}
+
+func hasParams(w http.ResponseWriter, call Call, names ...string) bool {
+	for _, name := range names {
+		if call.Params[name] == "" {
+			writeError(w, http.StatusBadRequest, "Bad Request: "+name+" is empty", 0)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request, call Call) {
+	writeResult(w, s.Bot)
+}
+
+// getUpdates confirms all updates before the offset and returns the
+// remaining ones, waiting up to the timeout for new updates.
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request, call Call) {
+	offset, _ := intParam(call, "offset")
+	timeout, _ := intParam(call, "timeout")
+	limit, ok := intParam(call, "limit")
+	if !ok || limit <= 0 || limit > 100 {
+		limit = 100
+	}
+
+	var allowed []string
+	if v, ok := call.Params["allowed_updates"]; ok {
+		err := json.Unmarshal([]byte(v), &allowed)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request: can't parse allowed_updates", 0)
+			return
+		}
+	}
+
+	deadline := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer deadline.Stop()
+
+	s.mu.Lock()
+	if allowed != nil {
+		// Like the API, remember the setting for later polls.
+		s.allowed = nil
+		if len(allowed) > 0 {
+			s.allowed = make(map[string]bool)
+			for _, name := range allowed {
+				s.allowed[name] = true
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		if s.webhook != "" {
+			s.mu.Unlock()
+			writeError(w, http.StatusConflict, "Conflict: can't use getUpdates method while webhook is active", 0)
+			return
+		}
+
+		if s.allowed != nil {
+			// Updates of other types are dropped.
+			kept := s.updates[:0]
+			for _, u := range s.updates {
+				if s.allowed[updateTypeName(u)] {
+					kept = append(kept, u)
+				}
+			}
+			s.updates = kept
+		}
+
+		if offset > 0 {
+			i := sort.Search(len(s.updates), func(i int) bool { return s.updates[i].ID >= offset })
+			s.updates = s.updates[i:]
+		} else if offset < 0 && -offset < len(s.updates) {
+			s.updates = s.updates[len(s.updates)+offset:]
+		}
+
+		n := len(s.updates)
+		if n > limit {
+			n = limit
+		}
+		updates := append([]tbotapi.Update{}, s.updates[:n]...)
+		newUpdate := s.newUpdate
+		s.mu.Unlock()
+
+		if len(updates) > 0 || timeout <= 0 {
+			writeResult(w, updates)
+			return
+		}
+
+		select {
+		case <-newUpdate:
+		case <-deadline.C:
+			writeResult(w, updates)
+			return
+		case <-s.closed:
+			writeResult(w, updates)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) setWebhook(w http.ResponseWriter, r *http.Request, call Call) {
+	s.mu.Lock()
+	s.webhook = call.Params["url"]
+	if call.Params["drop_pending_updates"] == "true" {
+		s.updates = nil
+	}
+	s.mu.Unlock()
+
+	writeResult(w, true)
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request, call Call) {
+	s.mu.Lock()
+	s.webhook = ""
+	if call.Params["drop_pending_updates"] == "true" {
+		s.updates = nil
+	}
+	s.mu.Unlock()
+
+	writeResult(w, true)
+}
+
+func (s *Server) getWebhookInfo(w http.ResponseWriter, r *http.Request, call Call) {
+	s.mu.Lock()
+	info := tbotapi.WebhookInfo{
+		URL:                s.webhook,
+		PendingUpdateCount: len(s.updates),
+	}
+	s.mu.Unlock()
+
+	writeResult(w, info)
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request, call Call) {
+	if !hasParams(w, call, "chat_id", "text") {
+		return
+	}
+
+	m := s.newMessage(call)
+	text := call.Params["text"]
+	m.Text = &text
+
+	writeResult(w, m)
+}
+
+func (s *Server) forwardMessage(w http.ResponseWriter, r *http.Request, call Call) {
+	if !hasParams(w, call, "chat_id", "from_chat_id", "message_id") {
+		return
+	}
+
+	m := s.newMessage(call)
+	m.ForwardDate = &m.Date
+
+	writeResult(w, m)
+}
+
+func (s *Server) sendLocation(w http.ResponseWriter, r *http.Request, call Call) {
+	if !hasParams(w, call, "chat_id", "latitude", "longitude") {
+		return
+	}
+
+	m := s.newMessage(call)
+	m.Location = parseLocation(call)
+
+	writeResult(w, m)
+}
+
+func (s *Server) sendVenue(w http.ResponseWriter, r *http.Request, call Call) {
+	if !hasParams(w, call, "chat_id", "latitude", "longitude", "title", "address") {
+		return
+	}
+
+	m := s.newMessage(call)
+	m.Venue = &tbotapi.Venue{
+		Location: *parseLocation(call),
+		Title:    call.Params["title"],
+		Address:  call.Params["address"],
+	}
+
+	writeResult(w, m)
+}
+
+// sendMedia implements all media senders. The file is either uploaded,
+// or given by the ID of a known file or a URL.
+func (s *Server) sendMedia(w http.ResponseWriter, r *http.Request, call Call) {
+	if !hasParams(w, call, "chat_id") {
+		return
+	}
+
+	fieldName := mediaFields[call.Method]
+	fileName := ""
+
+	s.mu.Lock()
+	var f tbotapi.File
+	if upload := call.File(fieldName); upload != nil {
+		f = s.addFile(upload.Content)
+		fileName = upload.FileName
+	} else if id := call.Params[fieldName]; s.files[id].file.ID != "" {
+		f = s.files[id].file
+	} else if strings.HasPrefix(id, "http://") || strings.HasPrefix(id, "https://") {
+		f = s.addFile(nil)
+	} else {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "Bad Request: wrong file identifier/HTTP URL specified", 0)
+		return
+	}
+	s.mu.Unlock()
+
+	m := s.newMessage(call)
+	if caption, ok := call.Params["caption"]; ok {
+		m.Caption = &caption
+	}
+	duration, _ := intParam(call, "duration")
+
+	switch call.Method {
+	case "sendPhoto":
+		m.Photo = &[]tbotapi.PhotoSize{{FileBase: f.FileBase}}
+	case "sendAudio":
+		m.Audio = &tbotapi.Audio{FileBase: f.FileBase, Duration: duration}
+	case "sendDocument":
+		m.Document = &tbotapi.Document{FileBase: f.FileBase, Name: fileName}
+	case "sendSticker":
+		m.Sticker = &tbotapi.Sticker{FileBase: f.FileBase}
+	case "sendVideo":
+		m.Video = &tbotapi.Video{FileBase: f.FileBase, Duration: duration, Caption: call.Params["caption"]}
+	case "sendVoice":
+		m.Voice = &tbotapi.Voice{FileBase: f.FileBase, Duration: duration}
+	}
+
+	writeResult(w, m)
+}
+
+func (s *Server) getUserProfilePhotos(w http.ResponseWriter, r *http.Request, call Call) {
+	if !hasParams(w, call, "user_id") {
+		return
+	}
+
+	writeResult(w, tbotapi.UserProfilePhotos{Photos: []tbotapi.PhotoSize{}})
+}
+
+func (s *Server) getFile(w http.ResponseWriter, r *http.Request, call Call) {
+	s.mu.Lock()
+	f, ok := s.files[call.Params["file_id"]]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Bad Request: invalid file id", 0)
+		return
+	}
+	writeResult(w, f.file)
+}
+
+func (s *Server) getChatMember(w http.ResponseWriter, r *http.Request, call Call) {
+	if !hasParams(w, call, "chat_id", "user_id") {
+		return
+	}
+	userID, err := strconv.Atoi(call.Params["user_id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: invalid user_id specified", 0)
+		return
+	}
+
+	s.mu.Lock()
+	member, ok := s.members[memberKey{call.Params["chat_id"], userID}]
+	s.mu.Unlock()
+
+	if !ok {
+		member = tbotapi.ChatMember{
+			User:   tbotapi.User{ID: userID},
+			Status: tbotapi.MemberStatusMember,
+		}
+	}
+	writeResult(w, member)
+}
+
+// newMessage creates a message sent by the bot to the chat given by the
+// chat_id parameter.
+func (s *Server) newMessage(call Call) tbotapi.Message {
+	s.mu.Lock()
+	id := s.nextMsg
+	s.nextMsg++
+	s.mu.Unlock()
+
+	m := tbotapi.Message{}
+	m.ID = id
+	m.Chat = parseChat(call.Params["chat_id"])
+	m.From = s.Bot
+	m.Date = int(time.Now().Unix())
+
+	return m
+}
+
+// parseChat derives a chat from a chat_id parameter.
+// Positive IDs are private chats, negative IDs groups, or supergroups if
+// they start with -100. @usernames are channels.
+func parseChat(chatID string) tbotapi.Chat {
+	if strings.HasPrefix(chatID, "@") {
+		username := chatID[1:]
+		return tbotapi.Chat{ID: -1001, Type: "channel", Username: &username}
+	}
+
+	id, _ := strconv.Atoi(chatID)
+	switch {
+	case id > 0:
+		return tbotapi.Chat{ID: id, Type: "private"}
+	case strings.HasPrefix(chatID, "-100"):
+		return tbotapi.Chat{ID: id, Type: "supergroup"}
+	default:
+		return tbotapi.Chat{ID: id, Type: "group"}
+	}
+}
+
+func parseLocation(call Call) *tbotapi.Location {
+	lat, _ := strconv.ParseFloat(call.Params["latitude"], 32)
+	long, _ := strconv.ParseFloat(call.Params["longitude"], 32)
+	return &tbotapi.Location{Latitude: float32(lat), Longitude: float32(long)}
+}
+
+// updateTypeName returns the name of the type of u as used in
+// allowed_updates.
+func updateTypeName(u tbotapi.Update) string {
+	switch {
+	case u.Message != nil:
+		return "message"
+	case u.InlineQuery != nil:
+		return "inline_query"
+	case u.ChosenInlineResult != nil:
+		return "chosen_inline_result"
+	case u.CallbackQuery != nil:
+		return "callback_query"
+	}
+	return ""
+}
@@ -0,0 +1,305 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// A Mode determines whether a Recorder records or replays.
+type Mode int
+
+// Recorder modes.
+const (
+	ModeRecord Mode = iota // Pass requests on and record them.
+	ModeReplay             // Answer requests from the cassette.
+	ModeAuto               // Replay if the cassette exists, record otherwise.
+)
+
+// A Cassette contains recorded API exchanges.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// An Interaction is one recorded API exchange.
+// The bot token is replaced by "<redacted>" everywhere.
+type Interaction struct {
+	Method   string            `json:"method"`
+	Params   map[string]string `json:"params,omitempty"`
+	Files    []FileInfo        `json:"files,omitempty"`
+	Response RecordedResponse  `json:"response"`
+}
+
+// FileInfo describes an uploaded file. Its content is not recorded.
+type FileInfo struct {
+	FieldName string `json:"field_name"`
+	FileName  string `json:"file_name"`
+	Size      int    `json:"size"`
+}
+
+// A RecordedResponse is the response to a recorded request.
+// JSON bodies are kept as they are, other bodies are kept as text.
+type RecordedResponse struct {
+	StatusCode  int             `json:"status_code"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	Text        string          `json:"text,omitempty"`
+}
+
+// ErrNoInteraction is returned in replay mode for requests that were not
+// recorded.
+var ErrNoInteraction = errors.New("tbotapitest: no matching interaction recorded")
+
+// A Recorder is an http.RoundTripper that records API exchanges to a
+// cassette file, or replays them from one.
+// Use it with tbotapi.WithHTTPClient:
+//
+//	rec, err := tbotapitest.NewRecorder("testdata/session.json", tbotapitest.ModeAuto, nil)
+//	// ...
+//	defer rec.Save()
+//	api, err := tbotapi.NewWithOptions(token, tbotapi.WithHTTPClient(rec.Client()))
+//
+// In replay mode, each request is answered with the first unused
+// interaction with the same method, params and files. Requests without a
+// matching interaction fail with ErrNoInteraction.
+type Recorder struct {
+	path string
+	mode Mode
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// NewRecorder creates a Recorder for the cassette at path.
+// In record mode, requests are passed on to next, or to
+// http.DefaultTransport if next is nil.
+// In replay mode, the cassette is loaded immediately.
+func NewRecorder(path string, mode Mode, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if mode == ModeAuto {
+		mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			mode = ModeReplay
+		}
+	}
+
+	r := &Recorder{path: path, mode: mode, next: next}
+	if mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(b, &r.cassette)
+		if err != nil {
+			return nil, fmt.Errorf("tbotapitest: invalid cassette %s: %s", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+
+	return r, nil
+}
+
+// Mode returns whether the Recorder records or replays.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an http.Client using the Recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Save writes the recorded interactions to the cassette file.
+// It does nothing in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	// HTML escaping is disabled to keep "<redacted>" readable.
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	r.mu.Lock()
+	err := enc.Encode(r.cassette)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(r.path, buf.Bytes(), 0644)
+}
+
+// Unused returns the interactions that were not replayed.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var toReturn []Interaction
+	for i, used := range r.used {
+		if !used {
+			toReturn = append(toReturn, r.cassette.Interactions[i])
+		}
+	}
+	return toReturn
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token := tokenFromPath(req.URL.Path)
+	in, err := interaction(req, body, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, in)
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	res, err := r.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	in.Response = RecordedResponse{
+		StatusCode:  res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	resBody = bytes.TrimSpace(redact(resBody, token))
+	if json.Valid(resBody) {
+		in.Response.Body = resBody
+	} else {
+		in.Response.Text = string(resBody)
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+func (r *Recorder) replay(req *http.Request, in Interaction) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, recorded := range r.cassette.Interactions {
+		if r.used[i] || !matches(recorded, in) {
+			continue
+		}
+		r.used[i] = true
+
+		body := []byte(recorded.Response.Body)
+		if len(body) == 0 {
+			body = []byte(recorded.Response.Text)
+		}
+		header := http.Header{}
+		if recorded.Response.ContentType != "" {
+			header.Set("Content-Type", recorded.Response.ContentType)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", recorded.Response.StatusCode, http.StatusText(recorded.Response.StatusCode)),
+			StatusCode:    recorded.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %v", ErrNoInteraction, in.Method, in.Params)
+}
+
+func matches(recorded, in Interaction) bool {
+	if recorded.Method != in.Method || len(recorded.Params) != len(in.Params) {
+		return false
+	}
+	for k, v := range in.Params {
+		if recorded.Params[k] != v {
+			return false
+		}
+	}
+	return reflect.DeepEqual(recorded.Files, in.Files)
+}
+
+// interaction describes a request, without its response.
+func interaction(req *http.Request, body []byte, token string) (Interaction, error) {
+	parsed := req.Clone(req.Context())
+	parsed.Body = io.NopCloser(bytes.NewReader(body))
+
+	call, err := parseCall(path.Base(req.URL.Path), parsed)
+	if err != nil {
+		return Interaction{}, err
+	}
+
+	in := Interaction{Method: call.Method}
+	if len(call.Params) > 0 {
+		in.Params = make(map[string]string, len(call.Params))
+		for k, v := range call.Params {
+			in.Params[k] = string(redact([]byte(v), token))
+		}
+	}
+	for _, f := range call.Files {
+		in.Files = append(in.Files, FileInfo{FieldName: f.FieldName, FileName: f.FileName, Size: len(f.Content)})
+	}
+
+	return in, nil
+}
+
+// tokenFromPath extracts the token from /bot<token>/<method> paths.
+func tokenFromPath(p string) string {
+	for _, segment := range strings.Split(p, "/") {
+		if strings.HasPrefix(segment, "bot") && strings.Contains(segment, ":") {
+			return segment[len("bot"):]
+		}
+	}
+	return ""
+}
+
+func redact(b []byte, token string) []byte {
+	if token == "" {
+		return b
+	}
+	return bytes.ReplaceAll(b, []byte(token), []byte("<redacted>"))
+}
@@ -0,0 +1,165 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapitest_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+// session sends a message mentioning the token and uploads a photo.
+func session(t *testing.T, api *tbotapi.TelegramBotAPI) *tbotapi.MessageResponse {
+	t.Helper()
+
+	resp, err := api.NewOutgoingMessage(tbotapi.NewChatRecipient(42), "token: "+tbotapitest.DefaultToken).Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.NewOutgoingPhoto(tbotapi.NewChatRecipient(42), "photo.jpg", strings.NewReader("jpeg")).Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	rec, err := tbotapitest.NewRecorder(path, tbotapitest.ModeAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Mode() != tbotapitest.ModeRecord {
+		t.Fatalf("mode without cassette = %d, want ModeRecord", rec.Mode())
+	}
+
+	api, err := s.NewBot(tbotapi.WithHTTPClient(rec.Client()), tbotapi.WithoutAutoStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := session(t, api)
+	api.Close()
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Calls()); n != 3 {
+		t.Fatalf("server received %d calls, want 3", n)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), tbotapitest.DefaultToken) {
+		t.Errorf("cassette contains the token:\n%s", b)
+	}
+	if !strings.Contains(string(b), "<redacted>") {
+		t.Errorf("cassette does not contain <redacted>:\n%s", b)
+	}
+
+	// The cassette exists now, so it is replayed without the server.
+	rec, err = tbotapitest.NewRecorder(path, tbotapitest.ModeAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Mode() != tbotapitest.ModeReplay {
+		t.Fatalf("mode with cassette = %d, want ModeReplay", rec.Mode())
+	}
+	s.Close()
+
+	api, err = tbotapi.NewWithOptions(tbotapitest.DefaultToken,
+		tbotapi.WithBaseURL(s.URL),
+		tbotapi.WithHTTPClient(rec.Client()),
+		tbotapi.WithoutAutoStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	if api.ID != s.Bot.ID || api.Username != *s.Bot.Username {
+		t.Errorf("replayed bot = %d %q, want %d %q", api.ID, api.Username, s.Bot.ID, *s.Bot.Username)
+	}
+	replayed := session(t, api)
+	if replayed.Message.ID != recorded.Message.ID {
+		t.Errorf("replayed message ID = %d, want %d", replayed.Message.ID, recorded.Message.ID)
+	}
+	if want := "token: <redacted>"; *replayed.Message.Text != want {
+		t.Errorf("replayed text = %q, want %q", *replayed.Message.Text, want)
+	}
+	if unused := rec.Unused(); len(unused) != 0 {
+		t.Errorf("unused interactions: %v", unused)
+	}
+
+	// All interactions are used up, so repeating a request fails.
+	_, err = api.NewOutgoingMessage(tbotapi.NewChatRecipient(42), "token: "+tbotapitest.DefaultToken).Send()
+	if !errors.Is(err, tbotapitest.ErrNoInteraction) {
+		t.Errorf("repeated request: err = %v, want ErrNoInteraction", err)
+	}
+}
+
+func TestRecorderUnmatched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	cassette := `{"interactions":[
+		{"method":"getMe","response":{"status_code":200,"content_type":"application/json","body":{"ok":true,"result":{"id":1,"first_name":"Bot","username":"bot"}}}},
+		{"method":"sendMessage","params":{"chat_id":"42","text":"hello"},"response":{"status_code":200,"content_type":"application/json","body":{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":42,"type":"private"},"text":"hello"}}}}
+	]}`
+	if err := os.WriteFile(path, []byte(cassette), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := tbotapitest.NewRecorder(path, tbotapitest.ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := tbotapi.NewWithOptions(tbotapitest.DefaultToken,
+		tbotapi.WithBaseURL("http://replay.invalid"),
+		tbotapi.WithHTTPClient(rec.Client()),
+		tbotapi.WithoutAutoStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	_, err = api.NewOutgoingMessage(tbotapi.NewChatRecipient(42), "goodbye").Send()
+	if !errors.Is(err, tbotapitest.ErrNoInteraction) {
+		t.Fatalf("err = %v, want ErrNoInteraction", err)
+	}
+	if !strings.Contains(err.Error(), "sendMessage") || !strings.Contains(err.Error(), "goodbye") {
+		t.Errorf("error %q does not name the unmatched request", err)
+	}
+
+	unused := rec.Unused()
+	if len(unused) != 1 || unused[0].Method != "sendMessage" {
+		t.Errorf("unused interactions = %v, want the sendMessage", unused)
+	}
+}
+
+func TestRecorderInvalidCassette(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := tbotapitest.NewRecorder(filepath.Join(dir, "missing.json"), tbotapitest.ModeReplay, nil)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing cassette: err = %v, want os.ErrNotExist", err)
+	}
+
+	path := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = tbotapitest.NewRecorder(path, tbotapitest.ModeReplay, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid cassette") {
+		t.Errorf("invalid cassette: err = %v", err)
+	}
+}
@@ -0,0 +1,469 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+// Package tbotapitest provides a fake Telegram Bot API server for testing
+// bots without talking to Telegram.
+//
+// The server runs in-process on top of net/http/httptest. Tests inject
+// updates, let the bot under test react to them and then inspect the
+// calls the bot made:
+//
+//	srv := tbotapitest.NewServer()
+//	defer srv.Close()
+//
+//	api, err := srv.NewBot()
+//	// ...
+//	srv.AddText(chat, user, "/start")
+//	// ...
+//	calls := srv.CallsTo("sendMessage")
+//
+// Error responses, like a 429 with retry_after, can be scripted with Fail.
+package tbotapitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+)
+
+// DefaultToken is the token of the bot served by NewServer.
+const DefaultToken = "123456789:TEST-token_for_tbotapitest"
+
+// A Call is a call the bot made to the server.
+type Call struct {
+	Method string            // The method, for example "sendMessage".
+	Params map[string]string // The parameters, JSON values are encoded as JSON.
+	Files  []File            // Files uploaded as multipart/form-data.
+	Time   time.Time         // When the call was received.
+}
+
+// A File is a file uploaded by the bot.
+type File struct {
+	FieldName string
+	FileName  string
+	Content   []byte
+}
+
+// A Failure is an error response scripted with Fail.
+type Failure struct {
+	StatusCode  int    // The HTTP status code, for example 403.
+	Description string // The description sent along.
+	RetryAfter  int    // If not zero, sent as parameters.retry_after.
+}
+
+// Forbidden returns a Failure answering like Telegram does if the user
+// blocked the bot.
+func Forbidden() Failure {
+	return Failure{StatusCode: http.StatusForbidden, Description: "Forbidden: bot was blocked by the user"}
+}
+
+// TooManyRequests returns a Failure asking the bot to wait retryAfter
+// seconds.
+func TooManyRequests(retryAfter int) Failure {
+	return Failure{
+		StatusCode:  http.StatusTooManyRequests,
+		Description: fmt.Sprintf("Too Many Requests: retry after %d", retryAfter),
+		RetryAfter:  retryAfter,
+	}
+}
+
+// ServerError returns a Failure answering with a non-JSON server error
+// with the given status code, like a failing proxy would.
+func ServerError(statusCode int) Failure {
+	return Failure{StatusCode: statusCode, Description: http.StatusText(statusCode)}
+}
+
+// A Server is a fake Telegram Bot API server.
+// All methods are safe for concurrent use.
+type Server struct {
+	URL   string       // The base URL, to be passed to tbotapi.WithBaseURL.
+	Token string       // The token the server accepts.
+	Bot   tbotapi.User // The user returned by getMe.
+
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	updates    []tbotapi.Update // Not yet confirmed by the bot.
+	nextUpdate int
+	nextMsg    int
+	nextFile   int
+	newUpdate  chan struct{} // Closed and replaced whenever updates are added.
+	closed     chan struct{}
+	calls      []Call
+	failures   map[string][]Failure
+	files      map[string]storedFile
+	members    map[memberKey]tbotapi.ChatMember
+	webhook    string
+	allowed    map[string]bool // The allowed_updates of the last poll, nil for all.
+}
+
+// A memberKey identifies a user in a chat, by the chat_id parameter.
+type memberKey struct {
+	chat string
+	user int
+}
+
+type storedFile struct {
+	file    tbotapi.File
+	content []byte
+}
+
+// NewServer starts a new Server serving a bot with DefaultToken.
+// The caller must call Close when finished.
+func NewServer() *Server {
+	username := "test_bot"
+	s := &Server{
+		Token: DefaultToken,
+		Bot: tbotapi.User{
+			ID:        123456789,
+			FirstName: "Test Bot",
+			Username:  &username,
+		},
+		nextUpdate: 1,
+		nextMsg:    1,
+		newUpdate:  make(chan struct{}),
+		closed:     make(chan struct{}),
+		failures:   make(map[string][]Failure),
+		files:      make(map[string]storedFile),
+		members:    make(map[memberKey]tbotapi.ChatMember),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+
+	return s
+}
+
+// Close shuts down the server.
+// Long polls in progress return immediately.
+func (s *Server) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+	s.mu.Unlock()
+
+	s.srv.Close()
+}
+
+// NewBot creates a client for the server.
+// It uses a poll timeout of one second, which can be overridden by opts.
+func (s *Server) NewBot(opts ...tbotapi.Option) (*tbotapi.TelegramBotAPI, error) {
+	o := []tbotapi.Option{
+		tbotapi.WithBaseURL(s.URL),
+		tbotapi.WithHTTPClient(s.srv.Client()),
+		tbotapi.WithPollTimeout(time.Second),
+	}
+	return tbotapi.NewWithOptions(s.Token, append(o, opts...)...)
+}
+
+// AddUpdate queues an update to be received by the bot and returns its ID.
+// If the ID of the update is zero, the next free ID is assigned.
+func (s *Server) AddUpdate(u tbotapi.Update) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == 0 {
+		u.ID = s.nextUpdate
+	}
+	if u.ID >= s.nextUpdate {
+		s.nextUpdate = u.ID + 1
+	}
+	s.updates = append(s.updates, u)
+	sort.Slice(s.updates, func(i, j int) bool { return s.updates[i].ID < s.updates[j].ID })
+
+	close(s.newUpdate)
+	s.newUpdate = make(chan struct{})
+
+	return u.ID
+}
+
+// AddMessage queues a message update and returns the update ID.
+// If the ID or the date of the message are zero, they are filled in.
+func (s *Server) AddMessage(m tbotapi.Message) int {
+	s.mu.Lock()
+	if m.ID == 0 {
+		m.ID = s.nextMsg
+		s.nextMsg++
+	}
+	s.mu.Unlock()
+	if m.Date == 0 {
+		m.Date = int(time.Now().Unix())
+	}
+
+	return s.AddUpdate(tbotapi.Update{Message: &m})
+}
+
+// AddText queues a text message sent by from to chat and returns the
+// update ID.
+func (s *Server) AddText(chat tbotapi.Chat, from tbotapi.User, text string) int {
+	m := tbotapi.Message{}
+	m.Chat = chat
+	m.From = from
+	m.Text = &text
+
+	return s.AddMessage(m)
+}
+
+// AddFile stores a file, which can then be resent by ID, retrieved with
+// getFile and downloaded.
+// It returns the file ID.
+func (s *Server) AddFile(content []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addFile(content).ID
+}
+
+// SetChatMember sets the member returned by getChatMember for the user
+// member.User in the chat with the given ID, for example to make a user an
+// administrator. Users that were not set are returned as members with the
+// status "member".
+func (s *Server) SetChatMember(chatID int, member tbotapi.ChatMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members[memberKey{strconv.Itoa(chatID), member.User.ID}] = member
+}
+
+// Fail makes the next calls to method fail with the given failures, one
+// failure per call.
+func (s *Server) Fail(method string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method] = append(s.failures[method], failures...)
+}
+
+// Calls returns all calls received so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsTo returns the calls to method received so far.
+func (s *Server) CallsTo(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var toReturn []Call
+	for _, c := range s.calls {
+		if c.Method == method {
+			toReturn = append(toReturn, c)
+		}
+	}
+	return toReturn
+}
+
+// PendingUpdates returns the number of updates not yet confirmed by the
+// bot.
+func (s *Server) PendingUpdates() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.updates)
+}
+
+// Webhook returns the webhook URL set by the bot, if any.
+func (s *Server) Webhook() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.webhook
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if p := strings.TrimPrefix(r.URL.Path, "/file/bot"+s.Token+"/"); p != r.URL.Path {
+		s.serveFile(w, p)
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/bot"+s.Token+"/")
+	if method == r.URL.Path {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", 0)
+		return
+	}
+
+	call, err := parseCall(method, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error(), 0)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	f, failed := s.nextFailure(method)
+	s.mu.Unlock()
+
+	if failed {
+		if f.StatusCode >= 500 {
+			http.Error(w, f.Description, f.StatusCode)
+			return
+		}
+		writeError(w, f.StatusCode, f.Description, f.RetryAfter)
+		return
+	}
+
+	h, ok := handlers[method]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found", 0)
+		return
+	}
+	h(s, w, r, call)
+}
+
+func (s *Server) nextFailure(method string) (Failure, bool) {
+	queue := s.failures[method]
+	if len(queue) == 0 {
+		return Failure{}, false
+	}
+	s.failures[method] = queue[1:]
+	return queue[0], true
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.files {
+		if f.file.Path == path {
+			w.Write(f.content)
+			return
+		}
+	}
+	http.NotFound(w, nil)
+}
+
+// addFile stores a file. s.mu must be held.
+func (s *Server) addFile(content []byte) tbotapi.File {
+	s.nextFile++
+	f := tbotapi.File{Path: fmt.Sprintf("files/file_%d", s.nextFile)}
+	f.ID = fmt.Sprintf("FILE%d", s.nextFile)
+	f.Size = len(content)
+
+	s.files[f.ID] = storedFile{file: f, content: content}
+	return f
+}
+
+// parseCall reads the parameters of a call from the query string or from
+// a JSON, form or multipart body.
+func parseCall(method string, r *http.Request) (Call, error) {
+	call := Call{Method: method, Params: make(map[string]string), Time: time.Now()}
+	for k, v := range r.URL.Query() {
+		call.Params[k] = v[0]
+	}
+
+	if r.Method != http.MethodPost {
+		return call, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var params map[string]json.RawMessage
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			return call, err
+		}
+		for k, v := range params {
+			var str string
+			if json.Unmarshal(v, &str) == nil {
+				call.Params[k] = str
+			} else {
+				call.Params[k] = string(v)
+			}
+		}
+	case "application/x-www-form-urlencoded":
+		err := r.ParseForm()
+		if err != nil {
+			return call, err
+		}
+		for k, v := range r.PostForm {
+			call.Params[k] = v[0]
+		}
+	case "multipart/form-data":
+		err := r.ParseMultipartForm(32 << 20)
+		if err != nil {
+			return call, err
+		}
+		for k, v := range r.MultipartForm.Value {
+			call.Params[k] = v[0]
+		}
+
+		fieldNames := make([]string, 0, len(r.MultipartForm.File))
+		for k := range r.MultipartForm.File {
+			fieldNames = append(fieldNames, k)
+		}
+		sort.Strings(fieldNames)
+
+		for _, k := range fieldNames {
+			for _, fh := range r.MultipartForm.File[k] {
+				f, err := fh.Open()
+				if err != nil {
+					return call, err
+				}
+				content, err := io.ReadAll(f)
+				f.Close()
+				if err != nil {
+					return call, err
+				}
+				call.Files = append(call.Files, File{FieldName: k, FileName: fh.Filename, Content: content})
+			}
+		}
+	}
+
+	return call, nil
+}
+
+// File returns the uploaded file with the given field name, or nil.
+func (c Call) File(fieldName string) *File {
+	for i := range c.Files {
+		if c.Files[i].FieldName == fieldName {
+			return &c.Files[i]
+		}
+	}
+	return nil
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":     true,
+		"result": result,
+	})
+}
+
+func writeError(w http.ResponseWriter, statusCode int, description string, retryAfter int) {
+	resp := map[string]interface{}{
+		"ok":          false,
+		"error_code":  statusCode,
+		"description": description,
+	}
+	if retryAfter != 0 {
+		resp["parameters"] = map[string]int{"retry_after": retryAfter}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// intParam parses an integer parameter.
+func intParam(call Call, name string) (int, bool) {
+	v, err := strconv.Atoi(call.Params[name])
+	return v, err == nil
+}
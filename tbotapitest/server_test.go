@@ -0,0 +1,297 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapitest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+// apiResponse is the envelope of all API responses.
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// post calls a method with form parameters and decodes the response.
+func post(t *testing.T, s *tbotapitest.Server, method string, params url.Values) (int, apiResponse) {
+	t.Helper()
+
+	resp, err := http.PostForm(s.URL+"/bot"+s.Token+"/"+method, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decode(t, resp)
+}
+
+func decode(t *testing.T, resp *http.Response) (int, apiResponse) {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var r apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, r
+}
+
+// updateIDs polls with the given parameters and returns the IDs received.
+func updateIDs(t *testing.T, s *tbotapitest.Server, params url.Values) []int {
+	t.Helper()
+
+	code, r := post(t, s, "getUpdates", params)
+	if code != http.StatusOK || !r.OK {
+		t.Fatalf("getUpdates: %d %s", code, r.Description)
+	}
+	var updates []tbotapi.Update
+	if err := json.Unmarshal(r.Result, &updates); err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, u := range updates {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func TestServerGetUpdatesOffset(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	chat := tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}
+	user := tbotapi.User{ID: 2, FirstName: "Alice"}
+	for i := 0; i < 5; i++ {
+		s.AddText(chat, user, "hello")
+	}
+
+	tests := []struct {
+		params  url.Values
+		want    []int
+		pending int
+	}{
+		{url.Values{}, []int{1, 2, 3, 4, 5}, 5},
+		{url.Values{"limit": {"2"}}, []int{1, 2}, 5},
+		{url.Values{"offset": {"2"}}, []int{2, 3, 4, 5}, 4},
+		{url.Values{"offset": {"1"}}, []int{2, 3, 4, 5}, 4}, // Confirmed updates stay confirmed.
+		{url.Values{"offset": {"-2"}}, []int{4, 5}, 2},
+		{url.Values{"offset": {"6"}}, []int{}, 0},
+	}
+
+	for _, test := range tests {
+		got := updateIDs(t, s, test.params)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getUpdates %v = %v, want %v", test.params, got, test.want)
+		}
+		if n := s.PendingUpdates(); n != test.pending {
+			t.Errorf("getUpdates %v: %d pending updates, want %d", test.params, n, test.pending)
+		}
+	}
+}
+
+func TestServerGetUpdatesLongPoll(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.AddText(tbotapi.Chat{ID: 1, Type: tbotapi.PrivateChatType}, tbotapi.User{ID: 2}, "hello")
+	}()
+
+	start := time.Now()
+	got := updateIDs(t, s, url.Values{"timeout": {"5"}})
+	if !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("long poll = %v, want [1]", got)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("long poll returned after %s, want right after the update was added", d)
+	}
+}
+
+func TestServerSendMessage(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	for i := 1; i <= 2; i++ {
+		code, r := post(t, s, "sendMessage", url.Values{"chat_id": {"42"}, "text": {"hello"}})
+		if code != http.StatusOK || !r.OK {
+			t.Fatalf("sendMessage: %d %s", code, r.Description)
+		}
+
+		var m tbotapi.Message
+		if err := json.Unmarshal(r.Result, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.ID != i || m.Chat.ID != 42 || m.Text == nil || *m.Text != "hello" {
+			t.Errorf("message %d = %d in chat %d, want the text echoed in chat 42", i, m.ID, m.Chat.ID)
+		}
+		if m.From.ID != s.Bot.ID {
+			t.Errorf("message %d from %d, want the bot %d", i, m.From.ID, s.Bot.ID)
+		}
+	}
+
+	calls := s.CallsTo("sendMessage")
+	if len(calls) != 2 || calls[0].Params["chat_id"] != "42" || calls[0].Params["text"] != "hello" {
+		t.Errorf("recorded calls = %v", calls)
+	}
+
+	code, r := post(t, s, "sendMessage", url.Values{"chat_id": {"42"}})
+	if code != http.StatusBadRequest || r.OK || r.ErrorCode != http.StatusBadRequest || r.Description != "Bad Request: text is empty" {
+		t.Errorf("sendMessage without text = %d %+v", code, r)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	tests := []struct {
+		path        string
+		code        int
+		description string
+	}{
+		{"/bot" + s.Token + "/sendTelepathy", http.StatusNotFound, "Not Found"},
+		{"/bot123:wrong/getMe", http.StatusUnauthorized, "Unauthorized"},
+	}
+
+	for _, test := range tests {
+		resp, err := http.PostForm(s.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q", test.path, ct)
+		}
+		code, r := decode(t, resp)
+		if code != test.code || r.OK || r.ErrorCode != test.code || r.Description != test.description || r.Result != nil {
+			t.Errorf("%s = %d %+v, want %d %q", test.path, code, r, test.code, test.description)
+		}
+	}
+
+	s.Fail("getMe", tbotapitest.TooManyRequests(3))
+	resp, err := http.Get(s.URL + "/bot" + s.Token + "/getMe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var r struct {
+		apiResponse
+		Parameters struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || r.OK || r.ErrorCode != http.StatusTooManyRequests || r.Parameters.RetryAfter != 3 {
+		t.Errorf("scripted failure = %d %+v", resp.StatusCode, r)
+	}
+}
+
+func TestServerUpload(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("chat_id", "42")
+	mw.WriteField("caption", "report")
+	fw, err := mw.CreateFormFile("document", "report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, "all good")
+	mw.Close()
+
+	resp, err := http.Post(s.URL+"/bot"+s.Token+"/sendDocument", mw.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, r := decode(t, resp)
+	if code != http.StatusOK || !r.OK {
+		t.Fatalf("sendDocument: %d %s", code, r.Description)
+	}
+
+	var m tbotapi.Message
+	if err := json.Unmarshal(r.Result, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Document == nil || m.Document.Name != "report.txt" || m.Document.Size != len("all good") {
+		t.Fatalf("sent document = %+v", m.Document)
+	}
+	if m.Caption == nil || *m.Caption != "report" {
+		t.Errorf("caption = %v, want report", m.Caption)
+	}
+
+	calls := s.CallsTo("sendDocument")
+	if len(calls) != 1 {
+		t.Fatalf("%d calls to sendDocument, want 1", len(calls))
+	}
+	want := []tbotapitest.File{{FieldName: "document", FileName: "report.txt", Content: []byte("all good")}}
+	if !reflect.DeepEqual(calls[0].Files, want) {
+		t.Errorf("uploaded files = %+v, want %+v", calls[0].Files, want)
+	}
+	if calls[0].Params["chat_id"] != "42" {
+		t.Errorf("chat_id = %q, want 42", calls[0].Params["chat_id"])
+	}
+
+	// The upload can be downloaded again.
+	code, r = post(t, s, "getFile", url.Values{"file_id": {m.Document.ID}})
+	if code != http.StatusOK || !r.OK {
+		t.Fatalf("getFile: %d %s", code, r.Description)
+	}
+	var f tbotapi.File
+	if err := json.Unmarshal(r.Result, &f); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(s.URL + "/file/bot" + s.Token + "/" + f.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "all good" {
+		t.Errorf("downloaded %q, want %q", content, "all good")
+	}
+}
+
+func TestServerUploadWithClient(t *testing.T) {
+	s := tbotapitest.NewServer()
+	defer s.Close()
+
+	api, err := s.NewBot(tbotapi.WithoutAutoStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	_, err = api.NewOutgoingPhoto(tbotapi.NewChatRecipient(42), "cat.jpg", strings.NewReader("meow")).Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := s.CallsTo("sendPhoto")
+	if len(calls) != 1 || len(calls[0].Files) != 1 {
+		t.Fatalf("calls to sendPhoto = %+v", calls)
+	}
+	if f := calls[0].File("photo"); f == nil || f.FileName != "cat.jpg" || string(f.Content) != "meow" {
+		t.Errorf("uploaded photo = %+v", f)
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// Defaults for WebhookConfig.
+const (
+	DefaultWebhookMaxBodySize = 1 << 20 // 1 MiB.
+	DefaultWebhookBufferSize  = 100
+)
+
+// WebhookConfig configures a WebhookServer.
+type WebhookConfig struct {
+	// MaxBodySize is the maximum size of a request body, in bytes.
+	// Defaults to DefaultWebhookMaxBodySize.
+	MaxBodySize int64
+
+	// BufferSize is the number of updates buffered until they are read
+	// from the Updates channel. If the buffer is full, requests are
+	// answered with 503 Service Unavailable, which makes the API retry
+	// them later.
+	// Defaults to DefaultWebhookBufferSize.
+	BufferSize int
+
+	// OnError is called with errors about rejected requests, for example
+	// malformed updates. It may be nil.
+	OnError func(err error)
+
+	// SecretToken is the secret token registered with SetWebhook. If set,
+	// requests without a matching X-Telegram-Bot-Api-Secret-Token header
+	// are rejected.
+	SecretToken string
+
+	// SourceIPRanges restricts the addresses requests are accepted from,
+	// usually to TelegramIPRanges(). If nil, requests from all addresses
+	// are accepted.
+	SourceIPRanges []netip.Prefix
+
+	// TrustedProxies are the address ranges of reverse proxies or load
+	// balancers in front of the server. For requests from those, the
+	// source address is taken from the X-Forwarded-For header: it is the
+	// last address in there that is not a trusted proxy itself.
+	TrustedProxies []netip.Prefix
+}
+
+// secretTokenHeader is the header the API sends the secret token in.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// TelegramIPRanges returns the address ranges Telegram sends webhook
+// requests from, as published in the API documentation.
+func TelegramIPRanges() []netip.Prefix {
+	return []netip.Prefix{
+		netip.MustParsePrefix("149.154.160.0/20"),
+		netip.MustParsePrefix("91.108.4.0/22"),
+	}
+}
+
+// GenerateSecretToken returns a random secret token suitable for
+// WebhookParams.SecretToken and WebhookConfig.SecretToken.
+func GenerateSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// A WebhookServer receives updates through a webhook and delivers them
+// on the Updates channel of a TelegramBotAPI.
+//
+// Requests are acknowledged right away, once the update is buffered.
+// A WebhookServer is an http.Handler and can be mounted on any server, or
+// serve itself using ListenAndServeTLS or Serve.
+type WebhookServer struct {
+	api   *TelegramBotAPI
+	cfg   WebhookConfig
+	queue chan Update
+
+	mu      sync.RWMutex  // Held for writing while stopping.
+	stopped chan struct{} // Closed once no more updates are accepted.
+	drained chan struct{} // Closed once the queue is empty after stopping.
+	srv     *http.Server  // Set by Serve, may be nil.
+}
+
+// NewWebhookServer creates a new WebhookServer delivering updates to api.
+// The client should be created with WithoutAutoStart, so that it does not
+// poll for updates at the same time.
+func (api *TelegramBotAPI) NewWebhookServer(cfg WebhookConfig) *WebhookServer {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultWebhookMaxBodySize
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultWebhookBufferSize
+	}
+
+	ws := &WebhookServer{
+		api:     api,
+		cfg:     cfg,
+		queue:   make(chan Update, cfg.BufferSize),
+		stopped: make(chan struct{}),
+		drained: make(chan struct{}),
+	}
+
+	api.wg.Add(1)
+	go ws.forward()
+
+	return ws
+}
+
+// forward delivers buffered updates until the server is stopped and the
+// queue is drained, or the client is closed.
+func (ws *WebhookServer) forward() {
+	defer ws.api.wg.Done()
+	defer close(ws.drained)
+
+	for {
+		select {
+		case <-ws.api.closed:
+			return
+		case u := <-ws.queue:
+			if !ws.api.deliver(BotUpdate{update: u}) {
+				return
+			}
+		case <-ws.stopped:
+			for {
+				select {
+				case u := <-ws.queue:
+					if !ws.api.deliver(BotUpdate{update: u}) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (ws *WebhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := ws.authorize(r); err != nil {
+		ws.reject(w, http.StatusForbidden, err)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		ws.reject(w, http.StatusMethodNotAllowed, errors.New("tbotapi: webhook request with method "+r.Method))
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		ws.reject(w, http.StatusUnsupportedMediaType, errors.New("tbotapi: webhook request with content type "+r.Header.Get("Content-Type")))
+		return
+	}
+
+	update := Update{}
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, ws.cfg.MaxBodySize)).Decode(&update)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ws.reject(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		ws.reject(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	select {
+	case <-ws.stopped:
+		ws.reject(w, http.StatusServiceUnavailable, errors.New("tbotapi: webhook server stopped"))
+		return
+	default:
+	}
+
+	select {
+	case ws.queue <- update:
+		w.WriteHeader(http.StatusOK)
+	default:
+		ws.reject(w, http.StatusServiceUnavailable, errors.New("tbotapi: webhook buffer full"))
+	}
+}
+
+// authorize checks the source address and the secret token of a request.
+func (ws *WebhookServer) authorize(r *http.Request) error {
+	if ws.cfg.SourceIPRanges != nil {
+		addr, err := ws.sourceAddr(r)
+		if err != nil {
+			return err
+		}
+		if !inRanges(addr, ws.cfg.SourceIPRanges) {
+			return fmt.Errorf("tbotapi: webhook request from %s", addr)
+		}
+	}
+
+	if ws.cfg.SecretToken != "" {
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(ws.cfg.SecretToken)) != 1 {
+			return errors.New("tbotapi: webhook request with invalid secret token")
+		}
+	}
+
+	return nil
+}
+
+// sourceAddr determines the address a request originates from, taking
+// trusted proxies into account.
+func (ws *WebhookServer) sourceAddr(r *http.Request) (netip.Addr, error) {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("tbotapi: webhook request with remote address %q: %w", r.RemoteAddr, err)
+	}
+	addr := ap.Addr().Unmap()
+	if !inRanges(addr, ws.cfg.TrustedProxies) {
+		return addr, nil
+	}
+
+	// Every proxy appends the address it received the request from, so
+	// the addresses are walked from the right.
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		next, err := netip.ParseAddr(hop)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("tbotapi: webhook request with X-Forwarded-For %q: %w", hop, err)
+		}
+		addr = next.Unmap()
+		if !inRanges(addr, ws.cfg.TrustedProxies) {
+			break
+		}
+	}
+
+	return addr, nil
+}
+
+func inRanges(addr netip.Addr, ranges []netip.Prefix) bool {
+	for _, p := range ranges {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ws *WebhookServer) reject(w http.ResponseWriter, code int, err error) {
+	if ws.cfg.OnError != nil {
+		ws.cfg.OnError(err)
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// Serve accepts connections on l and serves the webhook on all paths.
+// It returns http.ErrServerClosed after Shutdown.
+func (ws *WebhookServer) Serve(l net.Listener) error {
+	return ws.server().Serve(l)
+}
+
+// ListenAndServeTLS listens on addr and serves the webhook with TLS on all
+// paths, using the given certificate and key files.
+// It returns http.ErrServerClosed after Shutdown.
+func (ws *WebhookServer) ListenAndServeTLS(addr, certFile, keyFile string) error {
+	srv := ws.server()
+	srv.Addr = addr
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+func (ws *WebhookServer) server() *http.Server {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.srv == nil {
+		ws.srv = &http.Server{Handler: ws}
+	}
+	return ws.srv
+}
+
+// Shutdown stops accepting updates, shuts down the server started by Serve
+// or ListenAndServeTLS, if any, and waits until all buffered updates are
+// delivered to the Updates channel, or until ctx is done.
+// Updates are dropped if the client is closed in the meantime.
+func (ws *WebhookServer) Shutdown(ctx context.Context) error {
+	ws.mu.Lock()
+	select {
+	case <-ws.stopped:
+	default:
+		close(ws.stopped)
+	}
+	srv := ws.srv
+	ws.mu.Unlock()
+
+	var err error
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+
+	select {
+	case <-ws.drained:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2015-2016 mrd0ll4r and contributors. All rights reserved.
+// Use of this source code is governed by the MIT license, which can be found in
+// the LICENSE file.
+
+package tbotapi_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrd0ll4r/tbotapi"
+	"github.com/mrd0ll4r/tbotapi/tbotapitest"
+)
+
+const webhookUpdate = `{"update_id":1,"message":{"message_id":1,"date":1500000000,"chat":{"id":42,"type":"private"},"from":{"id":42,"first_name":"Test"},"text":"hello"}}`
+
+// webhookRequest describes a request to a webhook.
+type webhookRequest struct {
+	remote      string
+	xff         []string // X-Forwarded-For headers.
+	token       string
+	method      string // Defaults to POST.
+	contentType string // Defaults to application/json.
+	body        string // Defaults to webhookUpdate.
+}
+
+func (wr webhookRequest) serve(h http.Handler) *httptest.ResponseRecorder {
+	if wr.method == "" {
+		wr.method = http.MethodPost
+	}
+	if wr.contentType == "" {
+		wr.contentType = "application/json"
+	}
+	if wr.body == "" {
+		wr.body = webhookUpdate
+	}
+	if wr.remote == "" {
+		wr.remote = "149.154.160.1:443"
+	}
+
+	r := httptest.NewRequest(wr.method, "/", strings.NewReader(wr.body))
+	r.RemoteAddr = wr.remote
+	r.Header.Set("Content-Type", wr.contentType)
+	for _, xff := range wr.xff {
+		r.Header.Add("X-Forwarded-For", xff)
+	}
+	if wr.token != "" {
+		r.Header.Set("X-Telegram-Bot-Api-Secret-Token", wr.token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func newWebhookBot(t *testing.T) *tbotapi.TelegramBotAPI {
+	s := tbotapitest.NewServer()
+	t.Cleanup(s.Close)
+
+	api, err := s.NewBot(tbotapi.WithoutAutoStart())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(api.Close)
+	return api
+}
+
+func TestWebhookAuthorization(t *testing.T) {
+	api := newWebhookBot(t)
+	ws := api.NewWebhookServer(tbotapi.WebhookConfig{
+		SecretToken:    "s3cret",
+		SourceIPRanges: tbotapi.TelegramIPRanges(),
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+
+	tests := []struct {
+		name   string
+		req    webhookRequest
+		status int
+	}{
+		{"valid", webhookRequest{token: "s3cret"}, http.StatusOK},
+		{"missing token", webhookRequest{}, http.StatusForbidden},
+		{"wrong token", webhookRequest{token: "wrong"}, http.StatusForbidden},
+		{"token prefix", webhookRequest{token: "s3cre"}, http.StatusForbidden},
+
+		// Trusted proxies.
+		{"via proxy", webhookRequest{remote: "10.0.0.1:1234", xff: []string{"149.154.160.1"}, token: "s3cret"}, http.StatusOK},
+		{"via proxy chain", webhookRequest{remote: "10.0.0.1:1234", xff: []string{"149.154.160.1, 10.0.0.2"}, token: "s3cret"}, http.StatusOK},
+		{"via proxy, several headers", webhookRequest{remote: "10.0.0.1:1234", xff: []string{"149.154.160.1", "10.0.0.2"}, token: "s3cret"}, http.StatusOK},
+		{"via proxy, spoofed leftmost", webhookRequest{remote: "10.0.0.1:1234", xff: []string{"149.154.160.1, 203.0.113.5"}, token: "s3cret"}, http.StatusForbidden},
+		{"via proxy, spoofed first header", webhookRequest{remote: "10.0.0.1:1234", xff: []string{"149.154.160.1", "203.0.113.5"}, token: "s3cret"}, http.StatusForbidden},
+		{"via proxy, malformed", webhookRequest{remote: "10.0.0.1:1234", xff: []string{"149.154.160.1, garbage"}, token: "s3cret"}, http.StatusForbidden},
+		{"via proxy, no header", webhookRequest{remote: "10.0.0.1:1234", token: "s3cret"}, http.StatusForbidden},
+
+		// X-Forwarded-For is ignored for other peers.
+		{"untrusted peer", webhookRequest{remote: "203.0.113.5:1234", xff: []string{"149.154.160.1"}, token: "s3cret"}, http.StatusForbidden},
+		{"telegram with header", webhookRequest{remote: "149.154.160.1:443", xff: []string{"203.0.113.5"}, token: "s3cret"}, http.StatusOK},
+
+		// IPv4-mapped IPv6 addresses.
+		{"mapped peer", webhookRequest{remote: "[::ffff:149.154.160.1]:443", token: "s3cret"}, http.StatusOK},
+		{"mapped untrusted peer", webhookRequest{remote: "[::ffff:203.0.113.5]:443", token: "s3cret"}, http.StatusForbidden},
+		{"mapped proxy", webhookRequest{remote: "[::ffff:10.0.0.1]:1234", xff: []string{"149.154.160.1"}, token: "s3cret"}, http.StatusOK},
+		{"mapped in header", webhookRequest{remote: "10.0.0.1:1234", xff: []string{"::ffff:149.154.160.1"}, token: "s3cret"}, http.StatusOK},
+		{"IPv6 peer", webhookRequest{remote: "[2001:db8::1]:443", token: "s3cret"}, http.StatusForbidden},
+		{"malformed peer", webhookRequest{remote: "somewhere", token: "s3cret"}, http.StatusForbidden},
+
+		// Boundaries of TelegramIPRanges.
+		{"first of 149.154.160.0/20", webhookRequest{remote: "149.154.160.0:443", token: "s3cret"}, http.StatusOK},
+		{"last of 149.154.160.0/20", webhookRequest{remote: "149.154.175.255:443", token: "s3cret"}, http.StatusOK},
+		{"before 149.154.160.0/20", webhookRequest{remote: "149.154.159.255:443", token: "s3cret"}, http.StatusForbidden},
+		{"after 149.154.160.0/20", webhookRequest{remote: "149.154.176.0:443", token: "s3cret"}, http.StatusForbidden},
+		{"first of 91.108.4.0/22", webhookRequest{remote: "91.108.4.0:443", token: "s3cret"}, http.StatusOK},
+		{"last of 91.108.4.0/22", webhookRequest{remote: "91.108.7.255:443", token: "s3cret"}, http.StatusOK},
+		{"before 91.108.4.0/22", webhookRequest{remote: "91.108.3.255:443", token: "s3cret"}, http.StatusForbidden},
+		{"after 91.108.4.0/22", webhookRequest{remote: "91.108.8.0:443", token: "s3cret"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		if got := tt.req.serve(ws).Code; got != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, got, tt.status)
+		}
+	}
+}
+
+func TestWebhookWithoutRestrictions(t *testing.T) {
+	api := newWebhookBot(t)
+	ws := api.NewWebhookServer(tbotapi.WebhookConfig{})
+
+	req := webhookRequest{remote: "203.0.113.5:1234", xff: []string{"garbage"}, token: "anything"}
+	if got := req.serve(ws).Code; got != http.StatusOK {
+		t.Errorf("got status %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestWebhookRejectsRequests(t *testing.T) {
+	api := newWebhookBot(t)
+	var errs []error
+	ws := api.NewWebhookServer(tbotapi.WebhookConfig{
+		MaxBodySize: int64(len(webhookUpdate)),
+		OnError:     func(err error) { errs = append(errs, err) },
+	})
+
+	tests := []struct {
+		name   string
+		req    webhookRequest
+		status int
+	}{
+		{"valid", webhookRequest{}, http.StatusOK},
+		{"charset", webhookRequest{contentType: "application/json; charset=utf-8"}, http.StatusOK},
+		{"GET", webhookRequest{method: http.MethodGet}, http.StatusMethodNotAllowed},
+		{"plain text", webhookRequest{contentType: "text/plain"}, http.StatusUnsupportedMediaType},
+		{"form", webhookRequest{contentType: "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType},
+		{"malformed content type", webhookRequest{contentType: "application/json; ="}, http.StatusUnsupportedMediaType},
+		{"malformed JSON", webhookRequest{body: `{"update_id":`}, http.StatusBadRequest},
+		{"just too large", webhookRequest{body: webhookUpdate[:len(webhookUpdate)-1] + " }"}, http.StatusRequestEntityTooLarge},
+		{"much too large", webhookRequest{body: `{"update_id":1,"message":{"text":"` + strings.Repeat("a", 1<<20) + `"}}`}, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		errs = nil
+		w := tt.req.serve(ws)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if rejected := tt.status != http.StatusOK; rejected != (len(errs) == 1) {
+			t.Errorf("%s: got errors %v", tt.name, errs)
+		}
+		if tt.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("%s: got Allow %q, want %q", tt.name, w.Header().Get("Allow"), http.MethodPost)
+		}
+	}
+}
+
+func TestWebhookBackpressure(t *testing.T) {
+	api := newWebhookBot(t)
+	ws := api.NewWebhookServer(tbotapi.WebhookConfig{BufferSize: 1})
+
+	// Nobody reads the updates, so one is held by the forwarder and one
+	// is buffered. After that, requests are rejected.
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		code := webhookRequest{}.serve(ws).Code
+		if code == http.StatusServiceUnavailable {
+			break
+		}
+		if code != http.StatusOK {
+			t.Fatalf("got status %d, want %d or %d", code, http.StatusOK, http.StatusServiceUnavailable)
+		}
+		accepted++
+		time.Sleep(10 * time.Millisecond)
+	}
+	if accepted != 2 {
+		t.Fatalf("accepted %d updates with a full buffer, want 2", accepted)
+	}
+
+	// Reading an update makes room again.
+	<-api.Updates
+	deadline := time.Now().Add(5 * time.Second)
+	for (webhookRequest{}).serve(ws).Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("update not accepted after the buffer was read")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWebhookShutdown(t *testing.T) {
+	api := newWebhookBot(t)
+	ws := api.NewWebhookServer(tbotapi.WebhookConfig{})
+
+	for i := 0; i < 3; i++ {
+		if code := (webhookRequest{}).serve(ws).Code; code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", code, http.StatusOK)
+		}
+	}
+
+	// Shutdown waits until the buffered updates are delivered.
+	done := make(chan error)
+	go func() {
+		done <- ws.Shutdown(context.Background())
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-api.Updates:
+		case err := <-done:
+			t.Fatalf("Shutdown returned %v before all updates were delivered", err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if code := (webhookRequest{}).serve(ws).Code; code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d after Shutdown, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWebhookShutdownTimeout(t *testing.T) {
+	api := newWebhookBot(t)
+	ws := api.NewWebhookServer(tbotapi.WebhookConfig{})
+
+	if code := (webhookRequest{}).serve(ws).Code; code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+
+	// Nobody reads the update.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ws.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestWebhookShutdownInFlight(t *testing.T) {
+	api := newWebhookBot(t)
+	ws := api.NewWebhookServer(tbotapi.WebhookConfig{})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() {
+		served <- ws.Serve(l)
+	}()
+
+	// Send half of the body and keep the request open.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	half := len(webhookUpdate) / 2
+	fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: bot\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
+		len(webhookUpdate), webhookUpdate[:half])
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		done <- ws.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The request completes, but is not accepted anymore, so that the
+	// API sends it again later.
+	fmt.Fprint(conn, webhookUpdate[half:])
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for the request in flight, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve returned %v, want %v", err, http.ErrServerClosed)
+	}
+}